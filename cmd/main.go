@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/feitian/internal/conf"
 	"github.com/google/feitian/internal/server"
@@ -18,6 +21,8 @@ import (
 
 var configFilename string
 var configDirs string
+var envPrefix string
+var profile string
 
 func init() {
 	const (
@@ -27,18 +32,30 @@ func init() {
 	flag.StringVar(&configFilename, "c", defaultConfigFilename, "Name of the config file, without extension")
 	flag.StringVar(&configFilename, "dev_config", defaultConfigFilename, "Name of the config file, without extension")
 	flag.StringVar(&configDirs, "cPath", defaultConfigDirs, "Directories to search for config file, separated by ','")
+	flag.StringVar(&envPrefix, "envPrefix", config.DefaultEnvPrefix, "Prefix of env vars overriding config keys, e.g. APP_POSTGRESCONFIGURATION_PASSWORD")
+	flag.StringVar(&profile, "profile", "", "Config profile merged over the base file, e.g. dev, staging, prod (default <envPrefix>_PROFILE)")
 }
 
 func main() {
 	flag.Parse()
 
-	var appConfig conf.Config
-	if err := config.InitConfiguration(configFilename, strings.Split(configDirs, ","), &appConfig); err != nil {
+	manager, err := config.NewManager[conf.Config](configFilename, strings.Split(configDirs, ","), config.LoadOptions{EnvPrefix: envPrefix, Profile: profile})
+	if err != nil {
+		// Fail before connecting to anything, with every problem listed
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	appConfig := *manager.Get()
+	dump, err := config.Dump(appConfig)
+	if err != nil {
 		panic(err)
 	}
-	if b, err := json.MarshalIndent(appConfig, "", "  "); err == nil {
-		fmt.Println(string(b))
+	// Subcommand "config print" shows the effective configuration (secrets redacted) and exits
+	if flag.Arg(0) == "config" && flag.Arg(1) == "print" {
+		fmt.Println(string(dump))
+		return
 	}
+	fmt.Println(string(dump))
 	fmt.Println("Config loaded successfully!")
 
 	// Logger
@@ -68,7 +85,46 @@ func main() {
 	log.Info().Msg("Storage initialized")
 
 	s := server.NewServer(st, appConfig)
-	if err := s.Run(); err != nil {
-		log.Error().Msgf("Failed to start server %s", err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Reload on config file changes and secret rotation; invalid configs are rejected and logged
+	manager.Subscribe(func(old, new *conf.Config) { s.ApplyConfig(*old, *new) })
+	go func() {
+		if err := manager.Watch(ctx); err != nil {
+			log.Warn().Err(err).Msg("Config file is not watched")
+		}
+	}()
+	// Rotated secrets of live sections (e.g. AuthConfiguration.ApiKeys) apply at once; the Postgres
+	// and Redis passwords only on restart, which ApplyConfig logs
+	go manager.Secrets().WatchFiles(ctx, 30*time.Second, func(ref config.SecretRef, _ string) {
+		log.Info().Str("key", ref.Key).Msg("Secret file changed, reloading config")
+		if err := manager.Reload(); err != nil {
+			log.Error().Err(err).Msg("Config reload rejected, keeping the current config")
+		}
+	})
+
+	// Subcommand "worker" runs background job workers without the HTTP server
+	if flag.Arg(0) == "worker" {
+		if err := s.RunWorker(ctx); err != nil {
+			log.Error().Msgf("Failed to run worker %s", err)
+		}
+		return
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run() }()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.Error().Msgf("Failed to start server %s", err)
+		}
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			log.Error().Msgf("Failed to shut down server %s", err)
+		}
 	}
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/google/feitian/pkg/openrpc"
+	"github.com/google/feitian/pkg/rpcclient"
+)
+
+func runCall(ctx context.Context, client *rpcclient.Client, out printer, method string, args []string) int {
+	var params json.RawMessage
+	if len(args) == 1 {
+		data, err := readArg(args[0])
+		if err != nil {
+			fail(exitUsage, err)
+		}
+		if !json.Valid(data) {
+			fail(exitUsage, errors.New("params are not valid JSON"))
+		}
+		params = data
+	}
+	var result json.RawMessage
+	err := client.Call(ctx, method, params, &result)
+	if err != nil {
+		out.error(err)
+		return exitCode(err)
+	}
+	out.json(result)
+	return exitOK
+}
+
+type batchEntry struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Id     json.RawMessage `json:"id,omitempty"`
+}
+
+type batchOutput struct {
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *resp.RpcError  `json:"error,omitempty"`
+}
+
+func runBatch(ctx context.Context, client *rpcclient.Client, out printer, file string) int {
+	data, err := readArg("@" + file)
+	if file == "-" {
+		data, err = readArg("-")
+	}
+	if err != nil {
+		fail(exitUsage, err)
+	}
+	var entries []batchEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		fail(exitUsage, fmt.Errorf("invalid batch file: %w", err))
+	}
+
+	batch := client.Batch()
+	calls := make([]*rpcclient.BatchCall, len(entries))
+	results := make([]json.RawMessage, len(entries))
+	for i, e := range entries {
+		var params interface{}
+		if len(e.Params) > 0 {
+			params = e.Params
+		}
+		if len(e.Id) == 0 {
+			batch.Notify(e.Method, params)
+			continue
+		}
+		calls[i] = batch.Call(e.Method, params, &results[i])
+	}
+	if err := batch.Send(ctx); err != nil {
+		out.error(err)
+		return exitCode(err)
+	}
+
+	code := exitOK
+	var outputs []batchOutput
+	for i, call := range calls {
+		if call == nil {
+			continue
+		}
+		o := batchOutput{Method: call.Method, Result: results[i]}
+		if call.Err != nil {
+			if code == exitOK {
+				code = exitCode(call.Err)
+			}
+			if !errors.As(call.Err, &o.Error) {
+				o.Error = &resp.RpcError{Message: call.Err.Error()}
+			}
+		}
+		outputs = append(outputs, o)
+	}
+	out.value(outputs)
+	return code
+}
+
+func runList(ctx context.Context, client *rpcclient.Client, out printer) int {
+	var doc openrpc.Document
+	if err := client.Call(ctx, "rpc.discover", nil, &doc); err != nil {
+		out.error(err)
+		return exitCode(err)
+	}
+	if out.raw {
+		out.value(doc)
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tAUTH\tSUMMARY")
+	for _, m := range doc.Methods {
+		auth := ""
+		if m.XAuthRequired {
+			auth = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, auth, m.Summary)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// readArg returns arg itself, the contents of @file, or stdin for "-"
+func readArg(arg string) ([]byte, error) {
+	switch {
+	case arg == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(arg, "@"):
+		return os.ReadFile(arg[1:])
+	default:
+		return []byte(arg), nil
+	}
+}
+
+type printer struct {
+	raw bool
+}
+
+func (p printer) json(data json.RawMessage) {
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	var v interface{}
+	if p.raw || json.Unmarshal(data, &v) != nil {
+		fmt.Println(string(data))
+		return
+	}
+	p.value(v)
+}
+
+func (p printer) value(v interface{}) {
+	var data []byte
+	if p.raw {
+		data, _ = json.Marshal(v)
+	} else {
+		data, _ = json.MarshalIndent(v, "", "  ")
+	}
+	fmt.Println(string(data))
+}
+
+func (p printer) error(err error) {
+	var rpcErr *resp.RpcError
+	if errors.As(err, &rpcErr) {
+		data, _ := json.Marshal(rpcErr)
+		if !p.raw {
+			data, _ = json.MarshalIndent(rpcErr, "", "  ")
+		}
+		fmt.Fprintln(os.Stderr, string(data))
+		return
+	}
+	fmt.Fprintln(os.Stderr, "rpcctl:", err)
+}
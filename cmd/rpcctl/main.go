@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/google/feitian/pkg/rpcclient"
+)
+
+// Exit codes, so that scripts can branch on the kind of failure
+const (
+	exitOK             = 0
+	exitUsage          = 1
+	exitTransport      = 2
+	exitInvalidRequest = 3 // -32700, -32600
+	exitMethodNotFound = 4 // -32601
+	exitInvalidParams  = 5 // -32602
+	exitInternal       = 6 // -32603
+	exitRateLimited    = 7 // -32029
+	exitServerError    = 8 // any other error code
+	exitTimeout        = 9 // -32004
+)
+
+type headerFlags []string
+
+func (h *headerFlags) String() string     { return strings.Join(*h, ", ") }
+func (h *headerFlags) Set(v string) error { *h = append(*h, v); return nil }
+
+const usage = `Usage: rpcctl [flags] <command> [args]
+
+Commands:
+  call <method> [params]   call a method; params is JSON, @file or - for stdin
+  batch <file>             send a batch; file (or - for stdin) holds a JSON array of
+                           {"method", "params", "id"} objects, entries without id are notifications
+  list                     list methods via rpc.discover
+  ws subscribe <topic>     subscribe to a topic over WebSocket (not supported by this server)
+
+Exit codes: 0 ok, 1 usage, 2 transport/HTTP error, 3 invalid request, 4 method not found,
+5 invalid params, 6 internal error, 7 rate limited, 8 other server error, 9 timeout
+
+Flags:
+`
+
+func main() {
+	var (
+		profileName string
+		configPath  string
+		url         string
+		raw         bool
+		timeout     time.Duration
+		headers     headerFlags
+	)
+	flag.StringVar(&profileName, "profile", "", "Profile from the config file (default: the file's \"default\" entry)")
+	flag.StringVar(&configPath, "config", defaultConfigPath(), "Config file with profiles")
+	flag.StringVar(&url, "url", "", "Endpoint URL, overrides the profile")
+	flag.BoolVar(&raw, "raw", false, "Print compact JSON instead of pretty output")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "Request timeout")
+	flag.Var(&headers, "H", "Extra header \"Name: value\", may be repeated")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	p, err := loadProfile(configPath, profileName)
+	if err != nil {
+		fail(exitUsage, err)
+	}
+	if url != "" {
+		p.Url = url
+	}
+	header := make(http.Header)
+	for k, v := range p.Header {
+		header.Set(k, v)
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			fail(exitUsage, fmt.Errorf("invalid header %q, expected \"Name: value\"", h))
+		}
+		header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := rpcclient.New(p.Url, rpcclient.Options{
+		HTTPClient: &http.Client{Timeout: timeout},
+		Header:     header,
+	})
+	out := printer{raw: raw}
+	ctx := context.Background()
+
+	args := flag.Args()
+	switch args[0] {
+	case "call":
+		if len(args) < 2 || len(args) > 3 {
+			fail(exitUsage, errors.New("usage: rpcctl call <method> [params]"))
+		}
+		os.Exit(runCall(ctx, client, out, args[1], args[2:]))
+	case "batch":
+		if len(args) != 2 {
+			fail(exitUsage, errors.New("usage: rpcctl batch <file>"))
+		}
+		os.Exit(runBatch(ctx, client, out, args[1]))
+	case "list":
+		os.Exit(runList(ctx, client, out))
+	case "ws":
+		fail(exitUsage, errors.New("ws: not supported, the server exposes no WebSocket endpoint"))
+	default:
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+// exitCode maps an error from the client onto the documented exit codes
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var rpcErr *resp.RpcError
+	if !errors.As(err, &rpcErr) {
+		return exitTransport
+	}
+	switch rpcErr.Code {
+	case resp.ParseErrorCode, resp.InvalidRequestCode:
+		return exitInvalidRequest
+	case resp.MethodNotFoundCode:
+		return exitMethodNotFound
+	case resp.InvalidParamsCode:
+		return exitInvalidParams
+	case resp.InternalErrorCode:
+		return exitInternal
+	case resp.RateLimitedCode:
+		return exitRateLimited
+	case resp.TimeoutCode:
+		return exitTimeout
+	default:
+		return exitServerError
+	}
+}
+
+func fail(code int, err error) {
+	fmt.Fprintln(os.Stderr, "rpcctl:", err)
+	os.Exit(code)
+}
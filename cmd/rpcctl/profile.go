@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+const defaultUrl = "http://127.0.0.1:8080/api/rpc"
+
+// profile is one named target in the config file, e.g.
+//
+//	default = "local"
+//
+//	[profiles.local]
+//	url = "http://127.0.0.1:8080/api/rpc"
+//
+//	[profiles.prod]
+//	url = "https://api.example.com/api/rpc"
+//	header = { Authorization = "Bearer ..." }
+type profile struct {
+	Url    string            `mapstructure:"url"`
+	Header map[string]string `mapstructure:"header"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rpcctl", "config.toml")
+}
+
+// loadProfile returns the named profile; a missing config file yields the local default
+func loadProfile(path, name string) (profile, error) {
+	p := profile{Url: defaultUrl}
+	if path == "" {
+		return p, nil
+	}
+	vp := viper.New()
+	vp.SetConfigFile(path)
+	vp.SetConfigType("toml")
+	if err := vp.ReadInConfig(); err != nil {
+		if errors.Is(err, os.ErrNotExist) && name == "" {
+			return p, nil
+		}
+		return p, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	if name == "" {
+		name = vp.GetString("default")
+	}
+	if name == "" {
+		return p, nil
+	}
+	key := "profiles." + name
+	if !vp.IsSet(key) {
+		return p, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	if err := vp.UnmarshalKey(key, &p); err != nil {
+		return p, fmt.Errorf("profile %q: %w", name, err)
+	}
+	if p.Url == "" {
+		p.Url = defaultUrl
+	}
+	return p, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/feitian/internal/api"
+	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/internal/rpcgen"
+	"github.com/google/feitian/pkg/openrpc"
+)
+
+func main() {
+	var (
+		lang         string
+		source       string
+		out          string
+		pkg          string
+		clientImport string
+	)
+
+	flag.StringVar(&lang, "lang", "go", "Target language: go or ts")
+	flag.StringVar(&source, "in", "registry", "OpenRPC source: \"registry\" (methods compiled into this binary), a file path or an http(s) URL")
+	flag.StringVar(&out, "out", "", "Output file (default stdout)")
+	flag.StringVar(&pkg, "package", "apiclient", "Package name of the generated Go file")
+	flag.StringVar(&clientImport, "client-import", "github.com/google/feitian/pkg/rpcclient", "Import path of the rpcclient package")
+	flag.Parse()
+
+	doc, err := loadDocument(source)
+	if err != nil {
+		fail(err)
+	}
+
+	var code []byte
+	switch lang {
+	case "go":
+		code, err = rpcgen.Go(doc, rpcgen.GoOptions{Package: pkg, ClientImport: clientImport})
+	case "ts":
+		code, err = rpcgen.TypeScript(doc)
+	default:
+		err = fmt.Errorf("unsupported language %q", lang)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if out == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	if err := os.WriteFile(out, code, 0o644); err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Generated %s\n", out)
+}
+
+// loadDocument builds the document from the in-process method registry, or loads it from a file or URL
+func loadDocument(source string) (*openrpc.Document, error) {
+	if source == "registry" {
+		// Methods registered without storage; methods added by server.Server (e.g. admin ones) need a live server URL
+		return api.NewApiServerWithDeps(nil, conf.Config{}).OpenRPCDocument(), nil
+	}
+	return rpcgen.Load(source)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
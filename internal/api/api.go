@@ -1,12 +1,18 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/internal/api/explorer"
 	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/internal/jobs"
 	"github.com/google/feitian/internal/middleware"
 	"github.com/google/feitian/internal/storage"
+	"github.com/google/feitian/pkg/common/config"
 )
 
 type ApiServer struct {
@@ -14,10 +20,20 @@ type ApiServer struct {
 	conf       conf.Config
 	app        *gin.Engine
 	rpcHandler *RpcHandler
+	cache      *RpcCache
+	rateLimit  *RpcRateLimit
+	cors       *middleware.CorsPolicy
+	security   *middleware.SecurityHeaders
+	csrf       *middleware.CsrfGuard
+	panics     middleware.PanicReporter
+	compress   *middleware.Compression
+	jobs       *jobs.Queue
+	modules    []Module
+	httpServer *http.Server
 }
 
 func NewApiServer(port string) *ApiServer { // kept for backward-compat in case of external usage
-	return NewApiServerWithDeps(nil, conf.Config{ServiceConfiguration: struct{ Port string `mapstructure:"Port"`; Debug bool `mapstructure:"Debug"` }{Port: port}})
+	return NewApiServerWithDeps(nil, conf.Config{ServiceConfiguration: config.ServiceConfiguration{Port: port}})
 }
 
 func NewApiServerWithDeps(storage *storage.Storage, conf conf.Config) *ApiServer {
@@ -26,24 +42,125 @@ func NewApiServerWithDeps(storage *storage.Storage, conf conf.Config) *ApiServer
 		conf:       conf,
 		rpcHandler: NewRpcHandler(),
 	}
+	server.applyRpcConfig(conf)
+	cors, err := middleware.NewCorsPolicy(conf.CorsConfiguration)
+	if err != nil {
+		panic(err)
+	}
+	server.cors = cors
+	server.security = middleware.NewSecurityHeaders(conf.SecurityConfiguration)
+	server.csrf = middleware.NewCsrfGuard(conf.CsrfConfiguration, cors)
+	panics, err := middleware.NewFilePanicReporter(conf.LoggerConfiguration.PanicFile)
+	if err != nil {
+		panic(err)
+	}
+	server.SetPanicReporter(panics)
+	server.compress = middleware.NewCompression(conf.CompressionConfiguration)
+	// Interceptor order: logging sees every outcome, rate limiting rejects before any work,
+	// auth runs before anything that can answer from a stored result, and idempotency runs
+	// outside the cache so a replayed call never touches it.
+	// The rate limit is always installed so that reloading the config can enable it.
+	server.rateLimit = NewRpcRateLimit(newRateLimiter(conf.RateLimitConfiguration, storage), conf.RateLimitConfiguration)
+	server.rpcHandler.Use(LoggingInterceptor(), server.rateLimit.Interceptor(), AuthInterceptor())
+	if storage != nil && storage.GetRedis() != nil {
+		server.cache = NewRpcCache(storage.GetRedis())
+		server.rpcHandler.Use(NewRpcIdempotency(storage.GetRedis()).Interceptor(), server.cache.Interceptor())
+	}
 	server.registerRpcMethods()
 	return server
 }
 
+// ApplyConfig applies the settings that can change without a restart:
+// API keys, RPC timeouts and request limits, rate limiting rules, CORS, security headers, CSRF protection
+// and compression
+func (a *ApiServer) ApplyConfig(conf conf.Config) error {
+	a.applyRpcConfig(conf)
+	a.rateLimit.Update(conf.RateLimitConfiguration)
+	a.security.Update(conf.SecurityConfiguration)
+	a.csrf.Update(conf.CsrfConfiguration)
+	a.compress.Update(conf.CompressionConfiguration)
+	return a.cors.Update(conf.CorsConfiguration)
+}
+
+func (a *ApiServer) applyRpcConfig(conf conf.Config) {
+	a.rpcHandler.SetApiKeys(conf.AuthConfiguration.ApiKeys)
+	a.rpcHandler.SetDefaultTimeout(conf.RpcConfiguration.DefaultTimeout)
+	a.rpcHandler.SetLimits(RequestLimits{
+		MaxBodyBytes: conf.RpcConfiguration.MaxBodyBytes,
+		MaxBatchSize: conf.RpcConfiguration.MaxBatchSize,
+		MaxDepth:     conf.RpcConfiguration.MaxDepth,
+	})
+}
+
+// SetPanicReporter replaces the reporter of recovered panics, e.g. with an error tracker client
+func (a *ApiServer) SetPanicReporter(reporter middleware.PanicReporter) {
+	a.panics = reporter
+	a.rpcHandler.SetPanicReporter(reporter)
+}
+
+// Cache returns the RPC result cache, or nil without Redis
+func (a *ApiServer) Cache() *RpcCache {
+	return a.cache
+}
+
+// SetJobQueue lets RPC methods enqueue background jobs through a.jobs
+func (a *ApiServer) SetJobQueue(queue *jobs.Queue) {
+	a.jobs = queue
+}
+
 func (a *ApiServer) Run() error {
-	if a.app == nil {
-		a.app = gin.New()
-		a.app.Use(middleware.HttpRecover())
-		a.app.Use(gin.Logger())
-		a.app.Use(middleware.Cors())
+	handler, err := a.Handler()
+	if err != nil {
+		return err
+	}
+	a.httpServer = &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%s", a.conf.ServiceConfiguration.Port),
+		Handler: handler,
+	}
+	if err := a.httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler builds the engine serving every route on first use; Run serves it
+func (a *ApiServer) Handler() (http.Handler, error) {
+	if a.app != nil {
+		return a.app, nil
 	}
+	app := gin.New()
+	// Forwarded headers are only believed from the configured proxies, otherwise any client
+	// could pick its own IP and, with it, its rate limit bucket
+	if err := app.SetTrustedProxies(a.conf.ServiceConfiguration.TrustedProxies); err != nil {
+		return nil, err
+	}
+	app.Use(middleware.HttpRecover(a.panics))
+	app.Use(gin.Logger())
+	app.Use(a.security.Handler())
+	// CORS answers preflights before the CSRF check, which only looks at the actual requests
+	app.Use(a.cors.Handler(), a.csrf.Handler())
+	a.app = app
 	a.Router()
-	return a.app.Run(fmt.Sprintf("127.0.0.1:%s", a.conf.ServiceConfiguration.Port))
+	return a.app, nil
+}
+
+// Shutdown stops accepting requests, waits for in-flight ones and then runs the module shutdown hooks
+func (a *ApiServer) Shutdown(ctx context.Context) error {
+	var err error
+	if a.httpServer != nil {
+		err = a.httpServer.Shutdown(ctx)
+	}
+	return errors.Join(err, a.shutdownModules(ctx))
 }
 
 func (a *ApiServer) Router() {
 	a.app.GET("/health", a.HealthCheck)
-	a.app.POST("/api/rpc", a.Rpc)
+	a.app.POST("/api/rpc", a.compress.Handler(), a.Rpc)
+	a.app.GET("/api/rpc/openrpc.json", a.compress.Handler(), a.OpenRPC)
+	// The explorer lets anyone call methods from a browser, so it is only served in debug mode
+	if a.conf.ServiceConfiguration.Debug {
+		a.app.GET("/api/explorer", explorer.Handler())
+	}
 }
 
 func (a *ApiServer) HealthCheck(ctx *gin.Context) {
@@ -54,7 +171,10 @@ func (a *ApiServer) Rpc(ctx *gin.Context) {
 	a.rpcHandler.HandleRpcRequest(ctx)
 }
 
+// registerRpcMethods registers the built-in methods; service methods are registered as modules
 func (a *ApiServer) registerRpcMethods() {
-	a.rpcHandler.RegisterMethod(&PingMethod{})
-	a.rpcHandler.RegisterMethod(&EchoMethod{})
+	core := &coreModule{discover: &DiscoverMethod{handler: a.rpcHandler, info: a.openRPCInfo()}}
+	if err := a.RegisterModule(context.Background(), core); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		wantStatus int // of the second call, sent with another X-Forwarded-For
+	}{
+		{"no trusted proxies", nil, http.StatusTooManyRequests},
+		{"peer is not a trusted proxy", []string{"198.51.100.0/24"}, http.StatusTooManyRequests},
+		{"peer is a trusted proxy", []string{"203.0.113.0/24"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewApiServerWithDeps(nil, conf.Config{
+				ServiceConfiguration: config.ServiceConfiguration{Port: "8080", TrustedProxies: tt.proxies},
+				RateLimitConfiguration: config.RateLimitConfiguration{
+					Enabled: true,
+					Backend: "memory",
+					Rules:   []config.RateLimitRule{{Limit: 1, Window: time.Minute}},
+				},
+			})
+			handler, err := server.Handler()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status int
+			for _, forwardedFor := range []string{"1.2.3.4", "5.6.7.8"} {
+				req := httptest.NewRequest("POST", "/api/rpc", strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"ping"}`))
+				req.RemoteAddr = "203.0.113.9:4321"
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				status = w.Code
+			}
+			if status != tt.wantStatus {
+				t.Errorf("second call status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandlerRejectsInvalidProxies(t *testing.T) {
+	server := NewApiServerWithDeps(nil, conf.Config{
+		ServiceConfiguration: config.ServiceConfiguration{Port: "8080", TrustedProxies: []string{"not-an-ip"}},
+	})
+	if _, err := server.Handler(); err == nil {
+		t.Error("Handler accepted an invalid trusted proxy")
+	}
+}
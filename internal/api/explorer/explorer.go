@@ -0,0 +1,30 @@
+package explorer
+
+import (
+	"embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The page is a single self-contained file so that it works without network access
+
+//go:embed static/index.html
+var static embed.FS
+
+const contentSecurityPolicy = "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'"
+
+// Handler serves the API explorer page. It reads method metadata from
+// /api/rpc/openrpc.json and sends calls to /api/rpc.
+func Handler() gin.HandlerFunc {
+	page, err := static.ReadFile("static/index.html")
+	if err != nil {
+		panic(err)
+	}
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		// The page inlines its script and style, which the API-wide policy forbids
+		ctx.Header("Content-Security-Policy", contentSecurityPolicy)
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/feitian/internal/storage"
+)
+
+// Module groups the methods of one service area under a namespace:
+// a method named "get" in namespace "user" is served as "user.get".
+// The empty namespace registers methods under their own names.
+
+type Module interface {
+	Namespace() string
+	Methods() []RpcMethod
+}
+
+// ModuleInitializer is a Module that resolves its dependencies before its methods are served
+type ModuleInitializer interface {
+	Module
+	Init(ctx context.Context, storage *storage.Storage) error
+}
+
+// ModuleShutdowner is a Module that releases resources when the server stops
+type ModuleShutdowner interface {
+	Module
+	Shutdown(ctx context.Context) error
+}
+
+// RegisterModule initializes m and registers its methods under its namespace.
+// It fails without registering anything if a method name is invalid, repeated or already
+// taken, or if Init fails; names are checked before Init runs.
+func (a *ApiServer) RegisterModule(ctx context.Context, m Module) error {
+	namespace := strings.TrimSuffix(m.Namespace(), ".")
+	methods := m.Methods()
+	names := make([]string, len(methods))
+	for i, method := range methods {
+		names[i] = method.Name()
+		if namespace != "" {
+			names[i] = namespace + "." + method.Name()
+		}
+	}
+	a.rpcHandler.mu.RLock()
+	err := a.rpcHandler.checkNames(names)
+	a.rpcHandler.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("module %q: %w", namespace, err)
+	}
+
+	if initializer, ok := m.(ModuleInitializer); ok {
+		if err := initializer.Init(ctx, a.storage); err != nil {
+			return fmt.Errorf("module %q: init: %w", namespace, err)
+		}
+	}
+	// A name may have been taken since the check; undo Init then
+	if err := a.rpcHandler.registerMethods(names, methods); err != nil {
+		err = fmt.Errorf("module %q: %w", namespace, err)
+		if shutdowner, ok := m.(ModuleShutdowner); ok {
+			if shutdownErr := shutdowner.Shutdown(ctx); shutdownErr != nil {
+				err = errors.Join(err, fmt.Errorf("module %q: shutdown: %w", namespace, shutdownErr))
+			}
+		}
+		return err
+	}
+	a.modules = append(a.modules, m)
+	return nil
+}
+
+// shutdownModules runs the Shutdown hooks in reverse registration order
+func (a *ApiServer) shutdownModules(ctx context.Context) error {
+	var errs []error
+	for i := len(a.modules) - 1; i >= 0; i-- {
+		if shutdowner, ok := a.modules[i].(ModuleShutdowner); ok {
+			if err := shutdowner.Shutdown(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("module %q: shutdown: %w", a.modules[i].Namespace(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// coreModule holds the built-in methods, served without a namespace
+type coreModule struct {
+	discover *DiscoverMethod
+}
+
+func (m *coreModule) Namespace() string { return "" }
+
+func (m *coreModule) Methods() []RpcMethod {
+	return []RpcMethod{&PingMethod{}, &EchoMethod{}, m.discover}
+}
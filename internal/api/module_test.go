@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/internal/storage"
+	"github.com/google/feitian/pkg/common/config"
+)
+
+// testModule records its Init and Shutdown calls in events
+type testModule struct {
+	namespace string
+	names     []string
+	initErr   error
+	events    *[]string
+}
+
+func (m *testModule) Namespace() string { return m.namespace }
+
+func (m *testModule) Methods() []RpcMethod {
+	methods := make([]RpcMethod, len(m.names))
+	for i, name := range m.names {
+		methods[i] = &TypedMethod[struct{}, string]{MethodName: name, Handler: func(ctx context.Context, _ struct{}) (string, error) {
+			return name, nil
+		}}
+	}
+	return methods
+}
+
+func (m *testModule) Init(ctx context.Context, _ *storage.Storage) error {
+	*m.events = append(*m.events, "init "+m.namespace)
+	return m.initErr
+}
+
+func (m *testModule) Shutdown(ctx context.Context) error {
+	*m.events = append(*m.events, "shutdown "+m.namespace)
+	return nil
+}
+
+func newTestServer() *ApiServer {
+	return NewApiServerWithDeps(nil, conf.Config{ServiceConfiguration: config.ServiceConfiguration{Port: "8080"}})
+}
+
+// registeredMethods copies the method table of h
+func registeredMethods(h *RpcHandler) map[string]RpcMethod {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	methods := make(map[string]RpcMethod, len(h.methods))
+	for name, method := range h.methods {
+		methods[name] = method
+	}
+	return methods
+}
+
+func TestRegisterModuleNamespaces(t *testing.T) {
+	server := newTestServer()
+	var events []string
+	for _, m := range []*testModule{
+		{namespace: "user", names: []string{"get", "list"}, events: &events},
+		{namespace: "order.", names: []string{"get"}, events: &events},
+		{namespace: "", names: []string{"status"}, events: &events},
+	} {
+		if err := server.RegisterModule(context.Background(), m); err != nil {
+			t.Fatalf("RegisterModule(%q): %v", m.namespace, err)
+		}
+	}
+	for _, name := range []string{"ping", "user.get", "user.list", "order.get", "status"} {
+		w := postRpc(server.rpcHandler, `{"jsonrpc":"2.0","id":"1","method":"`+name+`"}`, nil)
+		if response := decodeResponse(t, w); response.Error != nil {
+			t.Errorf("%s: error %+v", name, response.Error)
+		}
+	}
+	for _, name := range []string{"get", "order..get"} {
+		if _, ok := server.rpcHandler.getMethod(name); ok {
+			t.Errorf("%s is registered", name)
+		}
+	}
+}
+
+func TestRegisterModuleRejects(t *testing.T) {
+	errInit := errors.New("no database")
+	tests := []struct {
+		name     string
+		module   testModule
+		wantInit bool
+	}{
+		{"name taken by another module", testModule{namespace: "user", names: []string{"create", "get"}}, false},
+		{"name taken by a core method", testModule{names: []string{"status", "ping"}}, false},
+		{"repeated within the module", testModule{namespace: "order", names: []string{"get", "create", "get"}}, false},
+		{"empty name", testModule{namespace: "order", names: []string{"get", ""}}, false},
+		{"name with spaces", testModule{namespace: "order", names: []string{"get", "get all"}}, false},
+		{"invalid namespace", testModule{namespace: ".order", names: []string{"get"}}, false},
+		{"init failure", testModule{namespace: "order", names: []string{"get"}, initErr: errInit}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			var events []string
+			if err := server.RegisterModule(context.Background(), &testModule{namespace: "user", names: []string{"get"}, events: &events}); err != nil {
+				t.Fatal(err)
+			}
+			events = nil
+			before := registeredMethods(server.rpcHandler)
+			m := tt.module
+			m.events = &events
+			err := server.RegisterModule(context.Background(), &m)
+			if err == nil {
+				t.Fatal("RegisterModule succeeded")
+			}
+			if tt.module.initErr != nil && !errors.Is(err, tt.module.initErr) {
+				t.Errorf("error = %v, want the Init error", err)
+			}
+			if ran := len(events) > 0; ran != tt.wantInit {
+				t.Errorf("Init ran = %v, want %v", ran, tt.wantInit)
+			}
+			after := registeredMethods(server.rpcHandler)
+			if len(after) != len(before) {
+				t.Errorf("%d methods registered, want %d", len(after), len(before))
+			}
+			for name, method := range before {
+				if after[name] != method {
+					t.Errorf("%s was replaced", name)
+				}
+			}
+			if len(server.modules) != 2 {
+				t.Errorf("modules = %d, want the rejected module left out", len(server.modules))
+			}
+		})
+	}
+}
+
+func TestModuleLifecycle(t *testing.T) {
+	server := newTestServer()
+	var events []string
+	for _, namespace := range []string{"user", "order", "billing"} {
+		if err := server.RegisterModule(context.Background(), &testModule{namespace: namespace, names: []string{"get"}, events: &events}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"init user", "init order", "init billing", "shutdown billing", "shutdown order", "shutdown user"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/internal/scheduler"
+	"github.com/google/feitian/pkg/common/config"
+)
+
+// AdminModule serves operational methods under the "admin" namespace; they all require auth (see AuthInterceptor).
+// config returns the current configuration; sched and cache may be nil when they are not available (no Redis).
+
+type AdminModule struct {
+	config    func() conf.Config
+	scheduler *scheduler.Scheduler
+	cache     *RpcCache
+}
+
+func NewAdminModule(config func() conf.Config, sched *scheduler.Scheduler, cache *RpcCache) *AdminModule {
+	return &AdminModule{config: config, scheduler: sched, cache: cache}
+}
+
+func (m *AdminModule) Namespace() string { return "admin" }
+
+func (m *AdminModule) Methods() []RpcMethod {
+	methods := []RpcMethod{&ConfigMethod{config: m.config}}
+	if m.scheduler != nil {
+		methods = append(methods, &SchedulerTasksMethod{scheduler: m.scheduler})
+	}
+	if m.cache != nil {
+		methods = append(methods, &CacheStatsMethod{cache: m.cache})
+	}
+	return methods
+}
+
+// ConfigMethod: returns the effective configuration with secrets redacted (admin)
+
+type ConfigMethod struct {
+	config func() conf.Config
+}
+
+func (m *ConfigMethod) Name() string { return "config" }
+
+func (m *ConfigMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return config.Redact(m.config()), nil
+}
+
+func (m *ConfigMethod) RequireAuth() bool { return true }
+
+// SchedulerTasksMethod: lists scheduled tasks with their last run (admin)
+
+type SchedulerTasksMethod struct {
+	scheduler *scheduler.Scheduler
+}
+
+func (m *SchedulerTasksMethod) Name() string { return "scheduler.tasks" }
+
+func (m *SchedulerTasksMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	tasks, err := m.scheduler.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"tasks": tasks}, nil
+}
+
+func (m *SchedulerTasksMethod) RequireAuth() bool { return true }
+
+// CacheStatsMethod: returns the RPC cache hit/miss counters of this replica per method (admin)
+
+type CacheStatsMethod struct {
+	cache *RpcCache
+}
+
+func (m *CacheStatsMethod) Name() string { return "cache.stats" }
+
+func (m *CacheStatsMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return map[string]any{"methods": m.cache.Stats()}, nil
+}
+
+func (m *CacheStatsMethod) RequireAuth() bool { return true }
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+const apiKeyHeader = "X-Api-Key"
+
+// SetApiKeys replaces the API keys accepted in the X-Api-Key header; only their digests are kept
+func (h *RpcHandler) SetApiKeys(keys []string) {
+	digests := make([][sha256.Size]byte, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			digests = append(digests, sha256.Sum256([]byte(key)))
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.apiKeys = digests
+}
+
+// verifyApiKey compares digests in constant time, so the time taken does not reveal how much of a key matched
+func (h *RpcHandler) verifyApiKey(key string) bool {
+	h.mu.RLock()
+	digests := h.apiKeys
+	h.mu.RUnlock()
+	sum := sha256.Sum256([]byte(key))
+	valid := 0
+	for _, digest := range digests {
+		valid |= subtle.ConstantTimeCompare(sum[:], digest[:])
+	}
+	return valid == 1
+}
+
+// requestPrincipal identifies the caller: "key:<api key>" for a configured API key, the client IP
+// otherwise. An unknown key is ignored rather than trusted, so it cannot be used to pick a rate limit;
+// the client IP is the peer address unless it is a trusted proxy (see ApiServer.Handler).
+func (h *RpcHandler) requestPrincipal(ctx *gin.Context) string {
+	if key := ctx.GetHeader(apiKeyHeader); key != "" && h.verifyApiKey(key) {
+		return "key:" + key
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// AuthInterceptor rejects calls to methods whose RequireAuth returns true unless the caller sent
+// a configured API key; it must run before any interceptor that can answer from a stored result
+func AuthInterceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			if call.Method.RequireAuth() && !authenticated(call.Principal) {
+				return nil, resp.NewError(resp.UnauthorizedCode, "authentication required: send a valid "+apiKeyHeader+" header", nil)
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// authenticated reports whether principal was derived from a verified API key
+func authenticated(principal string) bool {
+	return strings.HasPrefix(principal, "key:")
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+func newTestContext(headers map[string]string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("POST", "/api/rpc", nil)
+	ctx.Request.RemoteAddr = "192.0.2.7:4321"
+	for name, value := range headers {
+		ctx.Request.Header.Set(name, value)
+	}
+	return ctx
+}
+
+func TestRequestPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		sent string
+		want string
+	}{
+		{"no key sent", []string{"k1"}, "", "ip:192.0.2.7"},
+		{"configured key", []string{"k1", "k2"}, "k2", "key:k2"},
+		{"unknown key is not trusted", []string{"k1"}, "forged", "ip:192.0.2.7"},
+		{"prefix of a key", []string{"k1"}, "k", "ip:192.0.2.7"},
+		{"no keys configured", nil, "k1", "ip:192.0.2.7"},
+		{"empty entries are ignored", []string{""}, "", "ip:192.0.2.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRpcHandler()
+			h.SetApiKeys(tt.keys)
+			headers := map[string]string{}
+			if tt.sent != "" {
+				headers[apiKeyHeader] = tt.sent
+			}
+			if got := h.requestPrincipal(newTestContext(headers)); got != tt.want {
+				t.Errorf("requestPrincipal = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetApiKeysReplacesKeys(t *testing.T) {
+	h := NewRpcHandler()
+	h.SetApiKeys([]string{"old"})
+	h.SetApiKeys([]string{"new"})
+	if h.verifyApiKey("old") {
+		t.Error("a removed key is still accepted")
+	}
+	if !h.verifyApiKey("new") {
+		t.Error("the new key is rejected")
+	}
+}
+
+// postRpc serves body through h.HandleRpcRequest like the /api/rpc route
+func postRpc(h *RpcHandler, body string, headers map[string]string) *httptest.ResponseRecorder {
+	router := gin.New()
+	_ = router.SetTrustedProxies(nil)
+	router.POST("/api/rpc", h.HandleRpcRequest)
+	req := httptest.NewRequest("POST", "/api/rpc", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.7:4321"
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) resp.RpcResponse {
+	t.Helper()
+	var response resp.RpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	h := NewRpcHandler()
+	h.SetApiKeys([]string{"k1"})
+	h.Use(AuthInterceptor())
+	secret := func(ctx context.Context, _ struct{}) (string, error) { return "secret", nil }
+	h.RegisterMethod(&TypedMethod[struct{}, string]{MethodName: "admin.secret", Auth: true, Handler: secret})
+	h.RegisterMethod(&TypedMethod[struct{}, string]{MethodName: "public", Handler: secret})
+
+	tests := []struct {
+		name       string
+		method     string
+		key        string
+		wantStatus int
+		wantCode   int
+	}{
+		{"auth method without key", "admin.secret", "", http.StatusUnauthorized, resp.UnauthorizedCode},
+		{"auth method with unknown key", "admin.secret", "forged", http.StatusUnauthorized, resp.UnauthorizedCode},
+		{"auth method with configured key", "admin.secret", "k1", http.StatusOK, 0},
+		{"public method without key", "public", "", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.key != "" {
+				headers[apiKeyHeader] = tt.key
+			}
+			w := postRpc(h, `{"jsonrpc":"2.0","id":"1","method":"`+tt.method+`"}`, headers)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			response := decodeResponse(t, w)
+			switch {
+			case tt.wantCode == 0 && response.Error != nil:
+				t.Errorf("unexpected error %+v", response.Error)
+			case tt.wantCode != 0 && (response.Error == nil || response.Error.Code != tt.wantCode):
+				t.Errorf("error = %+v, want code %d", response.Error, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	cacheKeyPrefix = "rpc:cache:"
+	// cacheStoreTimeout bounds writing a computed result, which outlives the caller's ctx
+	cacheStoreTimeout = 5 * time.Second
+)
+
+// CachePolicy describes how the results of a method are cached
+// TTL: lifetime of an entry; Key: derives the cache key from params (defaults to a hash of the params);
+// Tags: groups entries so that other methods can invalidate them together;
+// Shared: for a method requiring auth, share entries between callers instead of keeping one per caller.
+
+type CachePolicy struct {
+	TTL    time.Duration
+	Key    func(params json.RawMessage) (string, error)
+	Tags   []string
+	Shared bool
+}
+
+// CacheableMethod is an RpcMethod whose results may be served from the cache
+
+type CacheableMethod interface {
+	RpcMethod
+	CachePolicy() CachePolicy
+}
+
+// CacheStats holds hit/miss counters of a single method
+
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+}
+
+type cacheCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+// RpcCache caches method results in Redis. Concurrent misses on the same key
+// are collapsed with single-flight so only one caller runs Execute.
+
+type RpcCache struct {
+	redis    *redis.Client
+	group    singleflight.Group
+	counters sync.Map // method name -> *cacheCounters
+}
+
+func NewRpcCache(redisConn *redis.Client) *RpcCache {
+	return &RpcCache{redis: redisConn}
+}
+
+// Do returns the cached result of method for params, or runs execute and stores its result.
+// Entries are kept per principal unless principal is empty, in which case every caller shares them.
+// Redis failures never fail the call: they are logged and execute is used directly.
+func (c *RpcCache) Do(ctx context.Context, method, principal string, policy CachePolicy, params json.RawMessage, execute func() (interface{}, error)) (interface{}, error) {
+	if c == nil || c.redis == nil || policy.TTL <= 0 {
+		return execute()
+	}
+	counters := c.countersFor(method)
+
+	key, err := cacheKey(method, principal, policy, params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	cached, err := c.redis.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		counters.hits.Add(1)
+		return json.RawMessage(cached), nil
+	case !errors.Is(err, redis.Nil):
+		counters.errors.Add(1)
+		log.Warn().Err(err).Str("method", method).Msg("rpc cache get failed")
+	}
+	counters.misses.Add(1)
+
+	// Each caller waits on its own ctx. The flight runs under the ctx of the caller that started it,
+	// so a follower whose leader was cancelled runs execute itself rather than failing with it.
+	leader := false
+	flight := c.group.DoChan(key, func() (interface{}, error) {
+		leader = true
+		result, err := execute()
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheStoreTimeout)
+		defer cancel()
+		if err := c.store(storeCtx, key, data, policy); err != nil {
+			counters.errors.Add(1)
+			log.Warn().Err(err).Str("method", method).Msg("rpc cache set failed")
+		}
+		return json.RawMessage(data), nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-flight:
+		if !leader && isContextError(res.Err) && ctx.Err() == nil {
+			return execute()
+		}
+		return res.Val, res.Err
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Interceptor serves methods implementing CacheableMethod through Do. The results of a method
+// requiring auth may depend on the caller, so they are cached per principal unless the policy is Shared.
+func (c *RpcCache) Interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			cacheable, ok := call.Method.(CacheableMethod)
+			if !ok {
+				return next(ctx, call)
+			}
+			policy := cacheable.CachePolicy()
+			principal := ""
+			if call.Method.RequireAuth() && !policy.Shared {
+				principal = call.Principal
+			}
+			return c.Do(ctx, call.Name, principal, policy, call.Params, func() (interface{}, error) {
+				return next(ctx, call)
+			})
+		}
+	}
+}
+
+// InvalidateTags drops every cached entry stored under any of the given tags
+func (c *RpcCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if c == nil || c.redis == nil {
+		return nil
+	}
+	for _, tag := range tags {
+		tagKey := cacheTagKey(tag)
+		keys, err := c.redis.SMembers(ctx, tagKey).Result()
+		if err != nil {
+			return err
+		}
+		if err := c.redis.Del(ctx, append(keys, tagKey)...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the hit/miss counters per method
+func (c *RpcCache) Stats() map[string]CacheStats {
+	stats := make(map[string]CacheStats)
+	if c == nil {
+		return stats
+	}
+	c.counters.Range(func(key, value any) bool {
+		counters := value.(*cacheCounters)
+		stats[key.(string)] = CacheStats{
+			Hits:   counters.hits.Load(),
+			Misses: counters.misses.Load(),
+			Errors: counters.errors.Load(),
+		}
+		return true
+	})
+	return stats
+}
+
+func (c *RpcCache) countersFor(method string) *cacheCounters {
+	if counters, ok := c.counters.Load(method); ok {
+		return counters.(*cacheCounters)
+	}
+	counters, _ := c.counters.LoadOrStore(method, &cacheCounters{})
+	return counters.(*cacheCounters)
+}
+
+func (c *RpcCache) store(ctx context.Context, key string, data []byte, policy CachePolicy) error {
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, policy.TTL)
+		for _, tag := range policy.Tags {
+			tagKey := cacheTagKey(tag)
+			pipe.SAdd(ctx, tagKey, key)
+			// Keep the tag index alive at least as long as its newest entry
+			pipe.ExpireGT(ctx, tagKey, policy.TTL)
+			pipe.ExpireNX(ctx, tagKey, policy.TTL)
+		}
+		return nil
+	})
+	return err
+}
+
+func cacheKey(method, principal string, policy CachePolicy, params json.RawMessage) (string, error) {
+	prefix := cacheKeyPrefix + method + ":"
+	if principal != "" {
+		prefix += hashPrincipal(principal) + ":"
+	}
+	if policy.Key != nil {
+		key, err := policy.Key(params)
+		if err != nil {
+			return "", err
+		}
+		return prefix + key, nil
+	}
+	hash, err := paramsHash(params)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hash, nil
+}
+
+func cacheTagKey(tag string) string {
+	return cacheKeyPrefix + "tag:" + tag
+}
+
+// paramsHash hashes the canonical form of params, so that whitespace and
+// object key order do not produce distinct keys. Numbers keep their literal text:
+// as float64, integers above 2^53 would collapse into one key.
+func paramsHash(params json.RawMessage) (string, error) {
+	canonical := []byte("null")
+	if len(params) > 0 {
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		canonical = b
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
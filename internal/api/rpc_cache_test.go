@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCache(t *testing.T) (*RpcCache, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRpcCache(client), mr
+}
+
+func TestCacheKey(t *testing.T) {
+	byId := CachePolicy{Key: func(params json.RawMessage) (string, error) {
+		var p struct {
+			Id string `json:"id"`
+		}
+		err := json.Unmarshal(params, &p)
+		return p.Id, err
+	}}
+	tests := []struct {
+		name      string
+		a, b      [2]string // principal, params
+		policy    CachePolicy
+		wantEqual bool
+	}{
+		{"same params", [2]string{"", `{"a":1}`}, [2]string{"", `{"a":1}`}, CachePolicy{}, true},
+		{"key order and spacing", [2]string{"", `{"a":1,"b":2}`}, [2]string{"", `{ "b": 2, "a": 1 }`}, CachePolicy{}, true},
+		{"different params", [2]string{"", `{"a":1}`}, [2]string{"", `{"a":2}`}, CachePolicy{}, false},
+		{"integers beyond float64 precision", [2]string{"", `{"id":9007199254740993}`}, [2]string{"", `{"id":9007199254740992}`}, CachePolicy{}, false},
+		{"large integers, spacing", [2]string{"", `{"id":9007199254740993}`}, [2]string{"", `{ "id" : 9007199254740993 }`}, CachePolicy{}, true},
+		{"different principals", [2]string{"key:k1", `{"a":1}`}, [2]string{"key:k2", `{"a":1}`}, CachePolicy{}, false},
+		{"principal and shared", [2]string{"key:k1", `{"a":1}`}, [2]string{"", `{"a":1}`}, CachePolicy{}, false},
+		{"custom key ignores other params", [2]string{"", `{"id":"x","page":1}`}, [2]string{"", `{"id":"x","page":2}`}, byId, true},
+		{"custom key keeps principals apart", [2]string{"key:k1", `{"id":"x"}`}, [2]string{"key:k2", `{"id":"x"}`}, byId, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := cacheKey("m", tt.a[0], tt.policy, json.RawMessage(tt.a[1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := cacheKey("m", tt.b[0], tt.policy, json.RawMessage(tt.b[1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == b) != tt.wantEqual {
+				t.Errorf("keys %q and %q: equal = %v, want %v", a, b, a == b, tt.wantEqual)
+			}
+		})
+	}
+	if _, err := cacheKey("m", "", CachePolicy{}, json.RawMessage(`{`)); err == nil {
+		t.Error("cacheKey accepted invalid params")
+	}
+}
+
+func TestCacheDo(t *testing.T) {
+	cache, mr := newTestCache(t)
+	policy := CachePolicy{TTL: time.Minute, Tags: []string{"users"}}
+	runs := 0
+	execute := func() (interface{}, error) {
+		runs++
+		return map[string]int{"run": runs}, nil
+	}
+	do := func(params string) string {
+		t.Helper()
+		result, err := cache.Do(context.Background(), "users.get", "", policy, json.RawMessage(params), execute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(result)
+		return string(data)
+	}
+
+	if got := do(`{"id":1}`); got != `{"run":1}` {
+		t.Errorf("first call = %s", got)
+	}
+	if got := do(`{"id":1}`); got != `{"run":1}` {
+		t.Errorf("second call = %s, want the cached result", got)
+	}
+	if got := do(`{"id":2}`); got != `{"run":2}` {
+		t.Errorf("other params = %s, want a fresh result", got)
+	}
+	if want := (CacheStats{Hits: 1, Misses: 2}); cache.Stats()["users.get"] != want {
+		t.Errorf("Stats = %+v, want %+v", cache.Stats()["users.get"], want)
+	}
+
+	if err := cache.InvalidateTags(context.Background(), "users"); err != nil {
+		t.Fatal(err)
+	}
+	if got := do(`{"id":1}`); got != `{"run":3}` {
+		t.Errorf("after invalidation = %s, want a fresh result", got)
+	}
+
+	// Failed calls are not cached
+	failing := func() (interface{}, error) { return nil, errors.New("boom") }
+	if _, err := cache.Do(context.Background(), "users.get", "", policy, json.RawMessage(`{"id":3}`), failing); err == nil {
+		t.Fatal("error was swallowed")
+	}
+	if got := do(`{"id":3}`); got != `{"run":4}` {
+		t.Errorf("after a failure = %s, want a fresh result", got)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if got := do(`{"id":2}`); got != `{"run":5}` {
+		t.Errorf("after the TTL = %s, want a fresh result", got)
+	}
+}
+
+func TestCacheWithoutStore(t *testing.T) {
+	cache, mr := newTestCache(t)
+	mr.Close()
+	runs := 0
+	for n := 0; n < 2; n++ {
+		if _, err := cache.Do(context.Background(), "m", "", CachePolicy{TTL: time.Minute}, nil, func() (interface{}, error) {
+			runs++
+			return "ok", nil
+		}); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("executed %d times, want 2 when Redis is down", runs)
+	}
+	if stats := cache.Stats()["m"]; stats.Errors == 0 {
+		t.Errorf("Stats = %+v, want errors counted", stats)
+	}
+}
+
+func TestCacheCollapsesConcurrentMisses(t *testing.T) {
+	cache, _ := newTestCache(t)
+	var runs atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for n := 0; n < 5; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Do(context.Background(), "m", "", CachePolicy{TTL: time.Minute}, nil, func() (interface{}, error) {
+				runs.Add(1)
+				<-release
+				return "ok", nil
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Errorf("executed %d times, want 1", n)
+	}
+}
+
+func TestCacheFollowerOutlivesCancelledLeader(t *testing.T) {
+	cache, _ := newTestCache(t)
+	policy := CachePolicy{TTL: time.Minute}
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := cache.Do(leaderCtx, "m", "", policy, nil, func() (interface{}, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+		leaderDone <- err
+	}()
+	<-started
+
+	followerDone := make(chan error, 1)
+	var result interface{}
+	go func() {
+		var err error
+		result, err = cache.Do(context.Background(), "m", "", policy, nil, func() (interface{}, error) {
+			return "follower", nil
+		})
+		followerDone <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancelLeader()
+
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want context.Canceled", err)
+	}
+	if err := <-followerDone; err != nil {
+		t.Fatalf("follower failed with its leader: %v", err)
+	}
+	if result != "follower" {
+		t.Errorf("follower result = %v, want its own", result)
+	}
+}
+
+// cachedMethod is a TypedMethod with a cache policy
+type cachedMethod struct {
+	TypedMethod[struct{}, string]
+	policy CachePolicy
+}
+
+func (m *cachedMethod) CachePolicy() CachePolicy { return m.policy }
+
+func TestCacheInterceptorScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     bool
+		shared   bool
+		wantRuns int32
+	}{
+		{"public method is shared", false, false, 1},
+		{"auth method is per caller", true, false, 2},
+		{"auth method with a shared policy", true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, _ := newTestCache(t)
+			h := NewRpcHandler()
+			h.SetApiKeys([]string{"k1", "k2"})
+			h.Use(cache.Interceptor())
+			var runs atomic.Int32
+			h.RegisterMethod(&cachedMethod{
+				TypedMethod: TypedMethod[struct{}, string]{MethodName: "m", Auth: tt.auth, Handler: func(ctx context.Context, _ struct{}) (string, error) {
+					runs.Add(1)
+					return "ok", nil
+				}},
+				policy: CachePolicy{TTL: time.Minute, Shared: tt.shared},
+			})
+			for _, key := range []string{"k1", "k1", "k2"} {
+				w := postRpc(h, `{"jsonrpc":"2.0","id":"1","method":"m"}`, map[string]string{apiKeyHeader: key})
+				if response := decodeResponse(t, w); response.Error != nil {
+					t.Fatalf("error %+v", response.Error)
+				}
+			}
+			if n := runs.Load(); n != tt.wantRuns {
+				t.Errorf("executed %d times, want %d", n, tt.wantRuns)
+			}
+		})
+	}
+}
@@ -1,18 +1,27 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/internal/middleware"
 	"github.com/google/feitian/pkg/common/resp"
 )
 
 // RpcMethod defines the interface for a JSON-RPC method
 // Name: method name; Execute: business logic; RequireAuth: whether it needs auth
-// For the base scaffold we do not implement auth; it always returns false.
+// Methods requiring auth are rejected by AuthInterceptor unless the caller sent a configured API key.
 
 type RpcMethod interface {
 	Name() string
@@ -21,12 +30,17 @@ type RpcMethod interface {
 }
 
 type RpcHandler struct {
-	methods map[string]RpcMethod
-	mu      sync.RWMutex
+	methods        map[string]RpcMethod
+	mu             sync.RWMutex
+	interceptors   []scopedInterceptor
+	defaultTimeout time.Duration
+	limits         RequestLimits
+	panics         middleware.PanicReporter
+	apiKeys        [][sha256.Size]byte
 }
 
 func NewRpcHandler() *RpcHandler {
-	return &RpcHandler{methods: make(map[string]RpcMethod)}
+	return &RpcHandler{methods: make(map[string]RpcMethod), limits: RequestLimits{}.withDefaults()}
 }
 
 func (h *RpcHandler) RegisterMethod(method RpcMethod) {
@@ -35,6 +49,40 @@ func (h *RpcHandler) RegisterMethod(method RpcMethod) {
 	h.methods[method.Name()] = method
 }
 
+// RegisterMethodAs registers method under name instead of method.Name(), e.g. with a module
+// namespace prefix; unlike RegisterMethod it refuses to replace a registered method
+func (h *RpcHandler) RegisterMethodAs(name string, method RpcMethod) error {
+	return h.registerMethods([]string{name}, []RpcMethod{method})
+}
+
+// registerMethods registers methods[i] under names[i], all or none
+func (h *RpcHandler) registerMethods(names []string, methods []RpcMethod) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.checkNames(names); err != nil {
+		return err
+	}
+	for i, name := range names {
+		h.methods[name] = methods[i]
+	}
+	return nil
+}
+
+// checkNames reports the first of names that is invalid, repeated or already registered; h.mu must be held
+func (h *RpcHandler) checkNames(names []string) error {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || strings.ContainsFunc(name, unicode.IsSpace) || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+			return fmt.Errorf("invalid method name %q", name)
+		}
+		if _, exists := h.methods[name]; exists || seen[name] {
+			return fmt.Errorf("method %s is already registered", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
 func (h *RpcHandler) getMethod(name string) (RpcMethod, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -42,30 +90,147 @@ func (h *RpcHandler) getMethod(name string) (RpcMethod, bool) {
 	return m, ok
 }
 
+// HandleRpcRequest serves a single call or a batch (JSON array of calls).
+// Notifications (calls without an id) are executed but get no response.
+// Calls run under the request context, so they are cancelled when the client disconnects.
 func (h *RpcHandler) HandleRpcRequest(ctx *gin.Context) {
-	var request resp.RpcRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		resp.ErrorReturn(ctx, request.Id, fmt.Errorf("invalid request: %v", err))
+	cancel, err := withClientDeadline(ctx)
+	if err != nil {
+		resp.Return(ctx, http.StatusBadRequest, "", nil, resp.NewError(resp.InvalidRequestCode, err.Error(), nil))
 		return
 	}
+	defer cancel()
 
-	if request.JsonRPC != "2.0" {
-		resp.ErrorReturn(ctx, request.Id, fmt.Errorf("unsupported jsonrpc version: %s", request.JsonRPC))
+	limits := h.getLimits()
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limits.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			resp.Return(ctx, http.StatusRequestEntityTooLarge, "", nil, resp.NewError(resp.RequestTooLargeCode,
+				fmt.Sprintf("request body exceeds %d bytes", limits.MaxBodyBytes), nil))
+			return
+		}
+		resp.ErrorReturn(ctx, "", resp.NewError(resp.ParseErrorCode, fmt.Sprintf("read request: %v", err), nil))
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if err := validateJSON(body, limits.MaxDepth); err != nil {
+		resp.ErrorReturn(ctx, "", err)
+		return
+	}
+	if body[0] == '[' {
+		h.handleBatch(ctx, body, limits.MaxBatchSize)
 		return
 	}
 
-	method, exists := h.getMethod(request.Method)
-	if !exists {
-		resp.ErrorReturn(ctx, request.Id, fmt.Errorf("method not found: %s", request.Method))
+	response := h.handleCall(ctx, body, false)
+	if response == nil {
+		ctx.Status(http.StatusNoContent)
 		return
 	}
+	status := http.StatusOK
+	if response.Error != nil {
+		switch response.Error.Code {
+		case resp.UnauthorizedCode:
+			status = http.StatusUnauthorized
+		case resp.RateLimitedCode:
+			setRetryAfter(ctx, response.Error)
+			status = http.StatusTooManyRequests
+		case resp.TimeoutCode:
+			status = http.StatusGatewayTimeout
+		}
+	}
+	resp.Write(ctx, status, response)
+}
 
-	// For base scaffold we skip auth check. If method.RequireAuth() returns true, still allow.
-	result, err := method.Execute(ctx, request.Params)
-	if err != nil {
-		resp.ErrorReturn(ctx, request.Id, err)
+func (h *RpcHandler) handleBatch(ctx *gin.Context, body []byte, maxBatchSize int) {
+	var calls []json.RawMessage
+	if err := json.Unmarshal(body, &calls); err != nil {
+		resp.ErrorReturn(ctx, "", resp.NewError(resp.ParseErrorCode, fmt.Sprintf("invalid batch: %v", err), nil))
+		return
+	}
+	if len(calls) == 0 {
+		resp.ErrorReturn(ctx, "", resp.NewError(resp.InvalidRequestCode, "empty batch", nil))
+		return
+	}
+	if len(calls) > maxBatchSize {
+		resp.Return(ctx, http.StatusRequestEntityTooLarge, "", nil, resp.NewError(resp.RequestTooLargeCode,
+			fmt.Sprintf("batch exceeds %d calls", maxBatchSize), nil))
 		return
 	}
 
-	resp.SimpleReturn(ctx, request.Id, result)
+	responses := make([]*resp.RpcResponse, 0, len(calls))
+	for _, call := range calls {
+		if response := h.handleCall(ctx, call, true); response != nil {
+			if response.Error != nil && response.Error.Code == resp.RateLimitedCode {
+				setRetryAfter(ctx, response.Error)
+			}
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+	resp.WriteBatch(ctx, http.StatusOK, responses)
+}
+
+// handleCall runs one call and returns its response, or nil for a notification
+func (h *RpcHandler) handleCall(ctx *gin.Context, raw json.RawMessage, inBatch bool) *resp.RpcResponse {
+	if !json.Valid(raw) {
+		return respond("", nil, resp.NewError(resp.ParseErrorCode, "parse error", nil))
+	}
+	var request resp.RpcRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return respond(request.Id, nil, resp.NewError(resp.InvalidRequestCode, fmt.Sprintf("invalid request: %v", err), nil))
+	}
+	notification := isNotification(raw)
+
+	if request.JsonRPC != "2.0" {
+		return respond(request.Id, nil, resp.NewError(resp.InvalidRequestCode, fmt.Sprintf("unsupported jsonrpc version: %s", request.JsonRPC), nil))
+	}
+
+	method, exists := h.getMethod(request.Method)
+	if !exists {
+		return h.reply(notification, request.Id, nil, resp.NewError(resp.MethodNotFoundCode, fmt.Sprintf("method not found: %s", request.Method), nil))
+	}
+
+	call := &Call{
+		Id:           request.Id,
+		Name:         request.Method,
+		Method:       method,
+		Params:       request.Params,
+		Principal:    h.requestPrincipal(ctx),
+		Notification: notification,
+		InBatch:      inBatch,
+		Request:      ctx,
+	}
+	// The Idempotency-Key header cannot tell batched calls apart, so batches use the params field only
+	call.IdempotencyKey = idempotencyKeyFromParams(request.Params)
+	if !inBatch {
+		call.IdempotencyKey = idempotencyKey(ctx, request.Params)
+	}
+
+	result, err := h.invoke(ctx, call)
+	return h.reply(notification, request.Id, result, err)
+}
+
+func (h *RpcHandler) reply(notification bool, id string, result interface{}, err error) *resp.RpcResponse {
+	if notification {
+		return nil
+	}
+	return respond(id, result, err)
+}
+
+func respond(id string, result interface{}, err error) *resp.RpcResponse {
+	response := resp.NewResponse(id, result, err)
+	return &response
+}
+
+// isNotification reports whether the call has no "id" member
+func isNotification(raw json.RawMessage) bool {
+	var probe struct {
+		Id *json.RawMessage `json:"id"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.Id == nil
 }
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/internal/storage"
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyPrefix = "rpc:idem:"
+
+	// idempotencyLockTTL is the TTL of the lock held by the first call; its watchdog renews it
+	// for as long as the call runs, so a slow call is never executed a second time
+	idempotencyLockTTL = 30 * time.Second
+	// idempotencyMaxWait bounds how long a duplicate waits for the first call to finish
+	idempotencyMaxWait  = time.Minute
+	idempotencyPollWait = 100 * time.Millisecond
+)
+
+// IdempotentMethod is an RpcMethod that accepts idempotency keys.
+// The first successful result is kept for IdempotencyTTL and replayed to retries.
+
+type IdempotentMethod interface {
+	RpcMethod
+	IdempotencyTTL() time.Duration
+}
+
+type idempotencyRecord struct {
+	ParamsHash string          `json:"params_hash"`
+	Done       bool            `json:"done"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+// RpcIdempotency stores first results in Redis and replays them for retried calls.
+// The first call holds a lock on the record while it runs; a pending record whose lock
+// is gone belongs to a call that died, and is taken over by the next retry.
+
+type RpcIdempotency struct {
+	redis  *redis.Client
+	locker storage.Locker
+}
+
+func NewRpcIdempotency(redisConn *redis.Client) *RpcIdempotency {
+	return &RpcIdempotency{redis: redisConn, locker: storage.NewRedisLocker(redisConn)}
+}
+
+// Do runs execute once per (method, principal, key); principal is empty for anonymous callers. A retry
+// with the same params gets the stored result, a retry with different params is rejected, and a concurrent
+// duplicate waits for the first call. Failed calls are not stored, so the client may retry them with the same key.
+func (i *RpcIdempotency) Do(ctx context.Context, method, principal, key string, ttl time.Duration, params json.RawMessage, execute func() (interface{}, error)) (interface{}, error) {
+	if i == nil || i.redis == nil || key == "" || ttl <= 0 {
+		return execute()
+	}
+	hash, err := paramsHash(params)
+	if err != nil {
+		return nil, resp.NewError(resp.InvalidParamsCode, "invalid params: "+err.Error(), nil)
+	}
+	recordKey := idempotencyRecordKey(method, principal, key)
+
+	lock, err := i.locker.TryLock(ctx, recordKey, idempotencyLockTTL)
+	if errors.Is(err, storage.ErrLockNotAcquired) {
+		return i.replay(ctx, recordKey, hash)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("method", method).Msg("idempotency store unavailable, executing without it")
+		return execute()
+	}
+	defer lock.Unlock(context.Background())
+
+	// The record outlives the lock: a call may have finished before we acquired it
+	record, found, err := i.load(ctx, recordKey)
+	if err != nil {
+		log.Warn().Err(err).Str("method", method).Msg("idempotency store unavailable, executing without it")
+		return execute()
+	}
+	if found && record.Done {
+		return replayRecord(record, hash)
+	}
+	pending, _ := json.Marshal(idempotencyRecord{ParamsHash: hash})
+	if err := i.redis.Set(ctx, recordKey, pending, ttl).Err(); err != nil {
+		log.Warn().Err(err).Str("method", method).Msg("idempotency store unavailable, executing without it")
+		return execute()
+	}
+
+	result, err := execute()
+	if err != nil {
+		i.release(recordKey)
+		return nil, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		i.release(recordKey)
+		return nil, err
+	}
+	done, _ := json.Marshal(idempotencyRecord{ParamsHash: hash, Done: true, Result: data})
+	// The call has run: store its result even if the client has gone meanwhile
+	if err := i.redis.Set(context.WithoutCancel(ctx), recordKey, done, ttl).Err(); err != nil {
+		log.Warn().Err(err).Str("method", method).Msg("failed to store idempotent result")
+	}
+	return json.RawMessage(data), nil
+}
+
+// Interceptor applies Do to methods implementing IdempotentMethod when the call carries a key
+func (i *RpcIdempotency) Interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			idempotent, ok := call.Method.(IdempotentMethod)
+			if !ok || call.IdempotencyKey == "" {
+				return next(ctx, call)
+			}
+			// Anonymous callers share one scope: their IP may change between retries, or be shared
+			owner := ""
+			if authenticated(call.Principal) {
+				owner = call.Principal
+			}
+			return i.Do(ctx, call.Name, owner, call.IdempotencyKey, idempotent.IdempotencyTTL(), call.Params, func() (interface{}, error) {
+				return next(ctx, call)
+			})
+		}
+	}
+}
+
+// replay waits until the first call finishes and returns its stored result
+func (i *RpcIdempotency) replay(ctx context.Context, recordKey, hash string) (interface{}, error) {
+	inProgress := resp.NewError(resp.IdempotencyInProgressCode, "request with this idempotency key is in progress", nil)
+	ticker := time.NewTicker(idempotencyPollWait)
+	defer ticker.Stop()
+	deadline := time.After(idempotencyMaxWait)
+	for {
+		record, found, err := i.load(ctx, recordKey)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, inProgress
+			}
+			return nil, err
+		}
+		if found && (record.Done || record.ParamsHash != hash) {
+			return replayRecord(record, hash)
+		}
+		// Not done: unless the first call still holds the lock, it failed or died
+		if lock, err := i.locker.TryLock(ctx, recordKey, idempotencyLockTTL); err == nil {
+			// It may also have finished between the read above and the lock
+			record, found, err = i.load(ctx, recordKey)
+			_ = lock.Unlock(context.Background())
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, inProgress
+				}
+				return nil, err
+			}
+			if found && record.Done {
+				return replayRecord(record, hash)
+			}
+			return nil, resp.NewError(resp.IdempotencyInProgressCode, "previous request with this idempotency key failed, retry", nil)
+		} else if ctx.Err() != nil {
+			return nil, inProgress
+		} else if !errors.Is(err, storage.ErrLockNotAcquired) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, inProgress
+		case <-deadline:
+			return nil, inProgress
+		case <-ticker.C:
+		}
+	}
+}
+
+// replayRecord returns the result of a finished record, or a conflict if it was stored for other params
+func replayRecord(record idempotencyRecord, hash string) (interface{}, error) {
+	if record.ParamsHash != hash {
+		return nil, resp.NewError(resp.IdempotencyConflictCode, "idempotency key reused with different params", nil)
+	}
+	return record.Result, nil
+}
+
+func (i *RpcIdempotency) load(ctx context.Context, recordKey string) (idempotencyRecord, bool, error) {
+	var record idempotencyRecord
+	raw, err := i.redis.Get(ctx, recordKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return record, false, nil
+	}
+	if err != nil {
+		return record, false, err
+	}
+	err = json.Unmarshal(raw, &record)
+	return record, err == nil, err
+}
+
+func (i *RpcIdempotency) release(recordKey string) {
+	// Use a fresh context: the request context may already be cancelled
+	if err := i.redis.Del(context.Background(), recordKey).Err(); err != nil {
+		log.Warn().Err(err).Str("key", recordKey).Msg("failed to release idempotency key")
+	}
+}
+
+func idempotencyRecordKey(method, principal, key string) string {
+	sum := sha256.Sum256([]byte(principal + "\x00" + key))
+	return idempotencyKeyPrefix + method + ":" + hex.EncodeToString(sum[:])
+}
+
+// idempotencyKey reads the key from the Idempotency-Key header, falling back to an
+// "idempotency_key" field in object params
+func idempotencyKey(ctx *gin.Context, params json.RawMessage) string {
+	if key := ctx.GetHeader(idempotencyKeyHeader); key != "" {
+		return key
+	}
+	return idempotencyKeyFromParams(params)
+}
+
+func idempotencyKeyFromParams(params json.RawMessage) string {
+	var fields struct {
+		Key string `json:"idempotency_key"`
+	}
+	if len(params) > 0 && params[0] == '{' {
+		_ = json.Unmarshal(params, &fields)
+	}
+	return fields.Key
+}
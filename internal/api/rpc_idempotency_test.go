@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestIdempotency(t *testing.T) (*RpcIdempotency, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRpcIdempotency(client), mr
+}
+
+func errorCode(err error) int {
+	var rpcErr *resp.RpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	return 0
+}
+
+func TestIdempotencyDo(t *testing.T) {
+	type call struct {
+		principal string
+		params    string
+		fail      bool
+		wantRuns  int
+		wantRun   int
+		wantCode  int
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{"retry is replayed", []call{
+			{params: `{"a":1}`, wantRuns: 1, wantRun: 1},
+			{params: `{"a":1}`, wantRuns: 1, wantRun: 1},
+		}},
+		{"params are compared after normalisation", []call{
+			{params: `{"a":1,"b":2}`, wantRuns: 1, wantRun: 1},
+			{params: `{ "b":2, "a":1 }`, wantRuns: 1, wantRun: 1},
+		}},
+		{"different params conflict", []call{
+			{params: `{"a":1}`, wantRuns: 1, wantRun: 1},
+			{params: `{"a":2}`, wantRuns: 1, wantCode: resp.IdempotencyConflictCode},
+		}},
+		{"large integers are compared exactly", []call{
+			{params: `{"id":9007199254740993}`, wantRuns: 1, wantRun: 1},
+			{params: `{"id":9007199254740992}`, wantRuns: 1, wantCode: resp.IdempotencyConflictCode},
+		}},
+		{"failure releases the key", []call{
+			{params: `{"a":1}`, fail: true, wantRuns: 1, wantCode: resp.InternalErrorCode},
+			{params: `{"a":1}`, wantRuns: 2, wantRun: 2},
+			{params: `{"a":1}`, wantRuns: 2, wantRun: 2},
+		}},
+		{"principals have separate scopes", []call{
+			{principal: "key:k1", params: `{"a":1}`, wantRuns: 1, wantRun: 1},
+			{principal: "key:k2", params: `{"a":1}`, wantRuns: 2, wantRun: 2},
+			{principal: "", params: `{"a":1}`, wantRuns: 3, wantRun: 3},
+			{principal: "key:k1", params: `{"a":1}`, wantRuns: 3, wantRun: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idem, _ := newTestIdempotency(t)
+			runs := 0
+			for n, c := range tt.calls {
+				result, err := idem.Do(context.Background(), "test.method", c.principal, "key-1", time.Minute, json.RawMessage(c.params), func() (interface{}, error) {
+					runs++
+					if c.fail {
+						return nil, resp.NewError(resp.InternalErrorCode, "boom", nil)
+					}
+					return map[string]int{"run": runs}, nil
+				})
+				if runs != c.wantRuns {
+					t.Errorf("call %d: executed %d times, want %d", n, runs, c.wantRuns)
+				}
+				if code := errorCode(err); code != c.wantCode {
+					t.Fatalf("call %d: error code %d (%v), want %d", n, code, err, c.wantCode)
+				}
+				if err == nil {
+					data, _ := json.Marshal(result)
+					if want := fmt.Sprintf(`{"run":%d}`, c.wantRun); string(data) != want {
+						t.Errorf("call %d: result %s, want %s", n, data, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyWaitsForRunningCall(t *testing.T) {
+	idem, _ := newTestIdempotency(t)
+	params := json.RawMessage(`{"a":1}`)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		_, err := idem.Do(context.Background(), "test.method", "", "key-1", time.Minute, params, func() (interface{}, error) {
+			close(started)
+			<-finish
+			return "first", nil
+		})
+		first <- err
+	}()
+	<-started
+
+	// A duplicate gives up while the first call holds the lock, without running
+	ctx, cancel := context.WithTimeout(context.Background(), 3*idempotencyPollWait)
+	defer cancel()
+	_, err := idem.Do(ctx, "test.method", "", "key-1", time.Minute, params, func() (interface{}, error) {
+		t.Error("duplicate executed while the first call was running")
+		return nil, nil
+	})
+	if code := errorCode(err); code != resp.IdempotencyInProgressCode {
+		t.Fatalf("error code %d (%v), want %d", code, err, resp.IdempotencyInProgressCode)
+	}
+
+	// A duplicate that waits long enough gets the first result
+	go func() {
+		time.Sleep(idempotencyPollWait)
+		close(finish)
+	}()
+	result, err := idem.Do(context.Background(), "test.method", "", "key-1", time.Minute, params, func() (interface{}, error) {
+		t.Error("duplicate executed after the first call finished")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("duplicate: %v", err)
+	}
+	if data, _ := json.Marshal(result); string(data) != `"first"` {
+		t.Errorf("duplicate result %s, want \"first\"", data)
+	}
+	if err := <-first; err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+}
+
+func TestIdempotencyTakesOverDeadCall(t *testing.T) {
+	idem, mr := newTestIdempotency(t)
+	params := json.RawMessage(`{"a":1}`)
+	hash, _ := paramsHash(params)
+	recordKey := idempotencyRecordKey("test.method", "", "key-1")
+
+	// A pending record without a lock belongs to a call that died
+	pending, _ := json.Marshal(idempotencyRecord{ParamsHash: hash})
+	mr.Set(recordKey, string(pending))
+	_, err := idem.Do(context.Background(), "test.method", "", "key-1", time.Minute, params, func() (interface{}, error) {
+		return "retried", nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	record, found, err := idem.load(context.Background(), recordKey)
+	if err != nil || !found || !record.Done || string(record.Result) != `"retried"` {
+		t.Errorf("record = %+v (found %v, err %v), want the retried result", record, found, err)
+	}
+	if mr.Exists("lock:" + recordKey) {
+		t.Error("lock is still held after the call")
+	}
+}
+
+func TestIdempotencyWithoutStore(t *testing.T) {
+	idem, mr := newTestIdempotency(t)
+	mr.Close()
+	runs := 0
+	for n := 0; n < 2; n++ {
+		if _, err := idem.Do(context.Background(), "test.method", "", "key-1", time.Minute, json.RawMessage(`{}`), func() (interface{}, error) {
+			runs++
+			return nil, nil
+		}); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+	if runs != 2 {
+		t.Errorf("executed %d times, want 2 when Redis is down", runs)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		params string
+		want   string
+	}{
+		{"header", "h1", `{}`, "h1"},
+		{"header wins over params", "h1", `{"idempotency_key":"p1"}`, "h1"},
+		{"params field", "", `{"idempotency_key":"p1"}`, "p1"},
+		{"array params", "", `["p1"]`, ""},
+		{"none", "", ``, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.header != "" {
+				headers[idempotencyKeyHeader] = tt.header
+			}
+			if got := idempotencyKey(newTestContext(headers), json.RawMessage(tt.params)); got != tt.want {
+				t.Errorf("idempotencyKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Call describes a single JSON-RPC call as it passes through the interceptor chain.
+// Name is the name the method is served under (including any module namespace), which may
+// differ from Method.Name(). Id is the request id ("" for a notification). Batched calls each
+// get their own Call; Request is the HTTP request shared by the batch, and must not be used
+// once the call's ctx is done.
+
+type Call struct {
+	Id             string
+	Name           string
+	Method         RpcMethod
+	Params         json.RawMessage
+	Principal      string
+	IdempotencyKey string
+	Notification   bool
+	InBatch        bool
+	Request        *gin.Context
+}
+
+// Handler executes a call and returns its result or error
+type Handler func(ctx context.Context, call *Call) (interface{}, error)
+
+// Interceptor wraps a Handler; it may inspect or replace the params, result and error,
+// or return without calling next to short-circuit the call
+type Interceptor func(next Handler) Handler
+
+type scopedInterceptor struct {
+	pattern     string
+	interceptor Interceptor
+}
+
+// Use registers interceptors that run around every call
+func (h *RpcHandler) Use(interceptors ...Interceptor) {
+	h.UseFor("*", interceptors...)
+}
+
+// UseFor registers interceptors for the methods matching pattern: an exact method
+// name ("user.get"), a prefix ending in "*" ("user.*"), or "*" for every method.
+//
+// Interceptors run in registration order regardless of scope: the first registered
+// is the outermost, and its code after next() runs last.
+func (h *RpcHandler) UseFor(pattern string, interceptors ...Interceptor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, interceptor := range interceptors {
+		h.interceptors = append(h.interceptors, scopedInterceptor{pattern: pattern, interceptor: interceptor})
+	}
+}
+
+// chain builds the handler for method from the matching interceptors around Execute
+func (h *RpcHandler) chain(method string) Handler {
+	h.mu.RLock()
+	interceptors := h.interceptors
+	h.mu.RUnlock()
+
+	handler := Handler(func(ctx context.Context, call *Call) (interface{}, error) {
+		return call.Method.Execute(ctx, call.Params)
+	})
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		if matchMethod(interceptors[i].pattern, method) {
+			handler = interceptors[i].interceptor(handler)
+		}
+	}
+	return handler
+}
+
+func matchMethod(pattern, method string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(method, prefix)
+	}
+	return pattern == method
+}
+
+// LoggingInterceptor logs every call with its duration and error at debug level.
+// The principal is logged hashed, as it may hold an API key.
+func LoggingInterceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			start := time.Now()
+			result, err := next(ctx, call)
+			log.Debug().
+				Err(err).
+				Str("method", call.Name).
+				Str("principal", hashPrincipal(call.Principal)).
+				Bool("batch", call.InBatch).
+				Dur("duration", time.Since(start)).
+				Msg("rpc call")
+			return result, err
+		}
+	}
+}
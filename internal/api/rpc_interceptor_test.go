@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		pattern, method string
+		want            bool
+	}{
+		{"*", "user.get", true},
+		{"user.get", "user.get", true},
+		{"user.get", "user.list", false},
+		{"user.*", "user.get", true},
+		{"user.*", "users.get", false},
+		{"user.*", "user", false},
+		{"user*", "users.get", true},
+	}
+	for _, tt := range tests {
+		if got := matchMethod(tt.pattern, tt.method); got != tt.want {
+			t.Errorf("matchMethod(%q, %q) = %v, want %v", tt.pattern, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestInterceptorOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) (interface{}, error) {
+				calls = append(calls, name+">")
+				result, err := next(ctx, call)
+				calls = append(calls, "<"+name)
+				return result, err
+			}
+		}
+	}
+	h := NewRpcHandler()
+	h.Use(record("global1"))
+	h.UseFor("user.*", record("user.*"))
+	h.UseFor("user.get", record("user.get"))
+	h.Use(record("global2"))
+	h.UseFor("admin.*", record("admin.*"), record("admin.*2"))
+
+	method := &TypedMethod[json.RawMessage, string]{Handler: func(ctx context.Context, _ json.RawMessage) (string, error) {
+		calls = append(calls, "execute")
+		return "ok", nil
+	}}
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{"user.get", "global1> user.*> user.get> global2> execute <global2 <user.get <user.* <global1"},
+		{"user.list", "global1> user.*> global2> execute <global2 <user.* <global1"},
+		{"users.get", "global1> global2> execute <global2 <global1"},
+		{"admin.stats", "global1> global2> admin.*> admin.*2> execute <admin.*2 <admin.* <global2 <global1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			calls = nil
+			result, err := h.chain(tt.method)(context.Background(), &Call{Name: tt.method, Method: method})
+			if err != nil || result != "ok" {
+				t.Fatalf("chain = %v, %v", result, err)
+			}
+			if got := strings.Join(calls, " "); got != tt.want {
+				t.Errorf("calls:\n  %s\nwant\n  %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	var calls []string
+	h := NewRpcHandler()
+	h.UseFor("cached.*", func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			calls = append(calls, "cache hit")
+			return "cached", nil
+		}
+	})
+	h.Use(func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			calls = append(calls, "inner")
+			return next(ctx, call)
+		}
+	})
+	method := &TypedMethod[json.RawMessage, string]{Handler: func(ctx context.Context, _ json.RawMessage) (string, error) {
+		calls = append(calls, "execute")
+		return "fresh", nil
+	}}
+	for _, name := range []string{"cached.get", "plain.get"} {
+		if err := h.RegisterMethodAs(name, method); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		method    string
+		want      string
+		wantCalls string
+	}{
+		// The scoped interceptor answers without running the ones registered after it
+		{"cached.get", `"cached"`, "cache hit"},
+		{"plain.get", `"fresh"`, "inner execute"},
+	}
+	for _, tt := range tests {
+		calls = nil
+		w := postRpc(h, `{"jsonrpc":"2.0","id":"1","method":"`+tt.method+`"}`, nil)
+		if response := decodeResponse(t, w); response.Error != nil || string(response.Result) != tt.want {
+			t.Errorf("%s: result %s, error %+v; want %s", tt.method, response.Result, response.Error, tt.want)
+		}
+		if got := strings.Join(calls, " "); got != tt.wantCalls {
+			t.Errorf("%s: calls %q, want %q", tt.method, got, tt.wantCalls)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// RequestLimits bounds what a single HTTP request may ask of the server; zero fields use the defaults
+// MaxBodyBytes: size of the request body; MaxBatchSize: calls per batch; MaxDepth: nesting of arrays and objects.
+
+type RequestLimits struct {
+	MaxBodyBytes int64
+	MaxBatchSize int
+	MaxDepth     int
+}
+
+const (
+	defaultMaxBodyBytes = 1 << 20
+	defaultMaxBatchSize = 100
+	defaultMaxDepth     = 32
+)
+
+func (l RequestLimits) withDefaults() RequestLimits {
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if l.MaxBatchSize <= 0 {
+		l.MaxBatchSize = defaultMaxBatchSize
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = defaultMaxDepth
+	}
+	return l
+}
+
+// SetLimits replaces the request limits
+func (h *RpcHandler) SetLimits(limits RequestLimits) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits = limits.withDefaults()
+}
+
+func (h *RpcHandler) getLimits() RequestLimits {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.limits
+}
+
+// validateJSON walks the whole document once and rejects syntax errors, trailing data,
+// nesting deeper than maxDepth and duplicate object keys (which encoding/json silently
+// resolves to the last one, so two layers could disagree on what a request means)
+func validateJSON(data []byte, maxDepth int) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+		keys      map[string]struct{}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var stack []*frame
+	values := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return resp.NewError(resp.ParseErrorCode, "parse error: "+err.Error(), nil)
+		}
+		if len(stack) == 0 {
+			if values++; values > 1 {
+				return resp.NewError(resp.ParseErrorCode, "parse error: unexpected data after JSON value", nil)
+			}
+		}
+		if n := len(stack); n > 0 && stack[n-1].expectKey {
+			if key, ok := tok.(string); ok {
+				top := stack[n-1]
+				if _, dup := top.keys[key]; dup {
+					return resp.NewError(resp.InvalidRequestCode, fmt.Sprintf("duplicate key %q", key), nil)
+				}
+				top.keys[key] = struct{}{}
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			if len(stack) >= maxDepth {
+				return resp.NewError(resp.InvalidRequestCode, fmt.Sprintf("JSON nesting exceeds %d levels", maxDepth), nil)
+			}
+			object := tok == json.Delim('{')
+			f := &frame{object: object, expectKey: object}
+			if object {
+				f.keys = make(map[string]struct{})
+			}
+			stack = append(stack, f)
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+		// A value (scalar or closed container) was completed; the enclosing object expects a key next
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+	if values == 0 {
+		return resp.NewError(resp.ParseErrorCode, "parse error: empty body", nil)
+	}
+	// Token reports a truncated document as a plain EOF
+	if len(stack) > 0 {
+		return resp.NewError(resp.ParseErrorCode, "parse error: unexpected end of JSON input", nil)
+	}
+	return nil
+}
+
+// DecodeParams decodes params into v, reporting failures as InvalidParamsCode.
+// With strict set, fields that v does not declare are rejected instead of ignored.
+func DecodeParams(params json.RawMessage, v interface{}, strict bool) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return resp.NewError(resp.InvalidParamsCode, "invalid params: "+err.Error(), nil)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		maxDepth int
+		wantCode int
+	}{
+		{"object", `{"a":1,"b":[1,2,{"c":null}]}`, 32, 0},
+		{"batch", `[{"a":1},{"a":1}]`, 32, 0},
+		{"same key in sibling objects", `{"a":{"x":1},"b":{"x":2}}`, 32, 0},
+		{"key equal to a value", `{"a":"a","b":"a"}`, 32, 0},
+		{"depth at the limit", `[[["x"]]]`, 3, 0},
+		{"depth over the limit", `[[[["x"]]]]`, 3, resp.InvalidRequestCode},
+		{"duplicate key", `{"method":"a","method":"b"}`, 32, resp.InvalidRequestCode},
+		{"nested duplicate key", `{"params":{"x":1,"x":2}}`, 32, resp.InvalidRequestCode},
+		{"syntax error", `{"a":}`, 32, resp.ParseErrorCode},
+		{"unterminated", `{"a":1`, 32, resp.ParseErrorCode},
+		{"trailing value", `{"a":1} {"a":2}`, 32, resp.ParseErrorCode},
+		{"empty", ``, 32, resp.ParseErrorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJSON([]byte(tt.data), tt.maxDepth)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Errorf("validateJSON = %v (code %d), want code %d", err, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	h := NewRpcHandler()
+	h.SetLimits(RequestLimits{MaxBodyBytes: 256, MaxBatchSize: 2, MaxDepth: 4})
+	echo := func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) { return params, nil }
+	h.RegisterMethod(&TypedMethod[json.RawMessage, json.RawMessage]{MethodName: "echo", Handler: echo})
+
+	call := `{"jsonrpc":"2.0","id":"1","method":"echo","params":{"a":1}}`
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   int
+	}{
+		{"single call", call, http.StatusOK, 0},
+		{"batch at the limit", "[" + call + "," + call + "]", http.StatusOK, 0},
+		{"batch over the limit", "[" + call + "," + call + "," + call + "]", http.StatusRequestEntityTooLarge, resp.RequestTooLargeCode},
+		{"empty batch", `[]`, http.StatusOK, resp.InvalidRequestCode},
+		{"body over the limit", `{"jsonrpc":"2.0","id":"1","method":"echo","params":"` + strings.Repeat("x", 256) + `"}`, http.StatusRequestEntityTooLarge, resp.RequestTooLargeCode},
+		{"nesting over the limit", `{"jsonrpc":"2.0","id":"1","method":"echo","params":[[[[1]]]]}`, http.StatusOK, resp.InvalidRequestCode},
+		{"duplicate method key", `{"jsonrpc":"2.0","id":"1","method":"echo","method":"other"}`, http.StatusOK, resp.InvalidRequestCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postRpc(h, tt.body, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if strings.HasPrefix(strings.TrimSpace(w.Body.String()), "[") {
+				if tt.wantCode != 0 {
+					t.Errorf("got a batch response %s, want error code %d", w.Body, tt.wantCode)
+				}
+				return
+			}
+			response := decodeResponse(t, w)
+			switch {
+			case tt.wantCode == 0 && response.Error != nil:
+				t.Errorf("unexpected error %+v", response.Error)
+			case tt.wantCode != 0 && (response.Error == nil || response.Error.Code != tt.wantCode):
+				t.Errorf("error = %+v, want code %d", response.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRequestLimitsDefaults(t *testing.T) {
+	got := RequestLimits{MaxBatchSize: 5}.withDefaults()
+	want := RequestLimits{MaxBodyBytes: defaultMaxBodyBytes, MaxBatchSize: 5, MaxDepth: defaultMaxDepth}
+	if got != want {
+		t.Errorf("withDefaults = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	type params struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name     string
+		params   string
+		strict   bool
+		wantCode int
+	}{
+		{"known fields", `{"name":"a"}`, true, 0},
+		{"unknown field, lenient", `{"name":"a","extra":1}`, false, 0},
+		{"unknown field, strict", `{"name":"a","extra":1}`, true, resp.InvalidParamsCode},
+		{"wrong type", `{"name":1}`, false, resp.InvalidParamsCode},
+		{"no params", ``, true, 0},
+		{"null params", `null`, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v params
+			err := DecodeParams(json.RawMessage(tt.params), &v, tt.strict)
+			if code := errorCode(err); code != tt.wantCode {
+				t.Errorf("DecodeParams = %v (code %d), want code %d", err, code, tt.wantCode)
+			}
+		})
+	}
+}
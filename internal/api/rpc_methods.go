@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"time"
 )
 
@@ -11,22 +12,41 @@ import (
 
 type PingMethod struct{}
 
+type PingResult struct {
+	Pong    bool   `json:"pong"`
+	Time    int64  `json:"time" description:"Server time, unix seconds"`
+	Message string `json:"message"`
+}
+
 func (m *PingMethod) Name() string { return "ping" }
 
 func (m *PingMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
-	return map[string]any{
-		"pong":    true,
-		"time":    time.Now().Unix(),
-		"message": "pong",
+	return PingResult{
+		Pong:    true,
+		Time:    time.Now().Unix(),
+		Message: "pong",
 	}, nil
 }
 
 func (m *PingMethod) RequireAuth() bool { return false }
 
+func (m *PingMethod) Describe() MethodDescription {
+	return MethodDescription{
+		Summary: "Health check",
+		Params:  reflect.TypeFor[struct{}](),
+		Result:  reflect.TypeFor[PingResult](),
+	}
+}
+
 // EchoMethod: echoes input params (no auth)
 
 type EchoMethod struct{}
 
+type EchoResult struct {
+	Echo map[string]any `json:"echo"`
+	Time int64          `json:"time" description:"Server time, unix seconds"`
+}
+
 func (m *EchoMethod) Name() string { return "echo" }
 
 func (m *EchoMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
@@ -36,10 +56,18 @@ func (m *EchoMethod) Execute(ctx context.Context, params json.RawMessage) (inter
 			return nil, fmt.Errorf("invalid params: %v", err)
 		}
 	}
-	return map[string]any{
-		"echo": input,
-		"time": time.Now().Unix(),
+	return EchoResult{
+		Echo: input,
+		Time: time.Now().Unix(),
 	}, nil
 }
 
 func (m *EchoMethod) RequireAuth() bool { return false }
+
+func (m *EchoMethod) Describe() MethodDescription {
+	return MethodDescription{
+		Summary: "Echoes the params back",
+		Params:  reflect.TypeFor[map[string]any](),
+		Result:  reflect.TypeFor[EchoResult](),
+	}
+}
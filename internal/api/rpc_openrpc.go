@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/google/feitian/pkg/openrpc"
+)
+
+// MethodDescription is the metadata published in the OpenRPC document
+// Params/Result: Go types reflected into JSON Schemas; Errors: codes the method may return.
+
+type MethodDescription struct {
+	Summary     string
+	Description string
+	Params      reflect.Type
+	Result      reflect.Type
+	Errors      []resp.RpcError
+}
+
+// DescribedMethod is an RpcMethod that publishes its metadata.
+// Methods that do not implement it are listed with free-form params and result.
+
+type DescribedMethod interface {
+	RpcMethod
+	Describe() MethodDescription
+}
+
+// TypedMethod adapts a typed handler into a DescribedMethod: params are decoded
+// into P and the schemas are reflected from P and R. Strict rejects params with
+// fields that P does not declare.
+
+type TypedMethod[P any, R any] struct {
+	MethodName  string
+	Summary     string
+	Description string
+	Auth        bool
+	Strict      bool
+	Errors      []resp.RpcError
+	Handler     func(ctx context.Context, params P) (R, error)
+}
+
+func (m *TypedMethod[P, R]) Name() string { return m.MethodName }
+
+func (m *TypedMethod[P, R]) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p P
+	if err := DecodeParams(params, &p, m.Strict); err != nil {
+		return nil, err
+	}
+	return m.Handler(ctx, p)
+}
+
+func (m *TypedMethod[P, R]) RequireAuth() bool { return m.Auth }
+
+func (m *TypedMethod[P, R]) Describe() MethodDescription {
+	return MethodDescription{
+		Summary:     m.Summary,
+		Description: m.Description,
+		Params:      reflect.TypeFor[P](),
+		Result:      reflect.TypeFor[R](),
+		Errors:      m.Errors,
+	}
+}
+
+// OpenRPCDocument builds the OpenRPC document of every registered method
+func (h *RpcHandler) OpenRPCDocument(info openrpc.Info) *openrpc.Document {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.methods))
+	for name := range h.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	methods := make([]RpcMethod, len(names))
+	for i, name := range names {
+		methods[i] = h.methods[name]
+	}
+	h.mu.RUnlock()
+
+	reflector := openrpc.NewReflector()
+	doc := &openrpc.Document{
+		OpenRPC:    openrpc.Version,
+		Info:       info,
+		Methods:    make([]openrpc.Method, 0, len(methods)),
+		Components: reflector.Components,
+	}
+	for i, m := range methods {
+		doc.Methods = append(doc.Methods, describeMethod(reflector, names[i], m))
+	}
+	return doc
+}
+
+func describeMethod(reflector *openrpc.Reflector, name string, m RpcMethod) openrpc.Method {
+	method := openrpc.Method{
+		Name:           name,
+		Params:         []*openrpc.ContentDescriptor{},
+		ParamStructure: "by-name",
+		XAuthRequired:  m.RequireAuth(),
+	}
+	described, ok := m.(DescribedMethod)
+	if !ok {
+		method.XParamsSchema = &openrpc.Schema{}
+		method.Result = &openrpc.ContentDescriptor{Name: "result", Schema: &openrpc.Schema{}}
+		return method
+	}
+
+	desc := described.Describe()
+	method.Summary = desc.Summary
+	method.Description = desc.Description
+	method.Result = &openrpc.ContentDescriptor{Name: "result", Schema: reflector.Schema(desc.Result)}
+
+	params := reflector.InlineSchema(desc.Params)
+	if params.Type == "object" && params.AdditionalProperties == nil {
+		required := make(map[string]bool, len(params.Required))
+		for _, name := range params.Required {
+			required[name] = true
+		}
+		names := make([]string, 0, len(params.Properties))
+		for name := range params.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			method.Params = append(method.Params, &openrpc.ContentDescriptor{
+				Name:        name,
+				Description: params.Properties[name].Description,
+				Required:    required[name],
+				Schema:      params.Properties[name],
+			})
+		}
+	} else {
+		method.XParamsSchema = params
+	}
+
+	for _, e := range desc.Errors {
+		method.Errors = append(method.Errors, &openrpc.Error{Code: e.Code, Message: e.Message, Data: e.Data})
+	}
+	return method
+}
+
+// DiscoverMethod: returns the OpenRPC document (rpc.discover convention)
+
+type DiscoverMethod struct {
+	handler *RpcHandler
+	info    openrpc.Info
+}
+
+func (m *DiscoverMethod) Name() string { return "rpc.discover" }
+
+func (m *DiscoverMethod) Execute(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return m.handler.OpenRPCDocument(m.info), nil
+}
+
+func (m *DiscoverMethod) RequireAuth() bool { return false }
+
+func (m *DiscoverMethod) Describe() MethodDescription {
+	return MethodDescription{
+		Summary: "Returns the OpenRPC document of this server",
+		Params:  reflect.TypeFor[struct{}](),
+	}
+}
+
+// OpenRPC serves the OpenRPC document over plain HTTP
+func (a *ApiServer) OpenRPC(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.OpenRPCDocument())
+}
+
+// OpenRPCDocument describes the methods registered on this server
+func (a *ApiServer) OpenRPCDocument() *openrpc.Document {
+	return a.rpcHandler.OpenRPCDocument(a.openRPCInfo())
+}
+
+func (a *ApiServer) openRPCInfo() openrpc.Info {
+	return openrpc.Info{Title: "JSON-RPC API", Version: "1.0.0"}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/internal/storage"
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/google/feitian/pkg/common/ratelimit"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// RpcRateLimit applies the configured rules before a method is executed.
+// Two scopes are checked per call: all methods combined and the called method.
+// Within a scope the rule naming the principal wins over the generic rule.
+
+type RpcRateLimit struct {
+	limiter ratelimit.Limiter
+	mu      sync.RWMutex
+	enabled bool
+	rules   []config.RateLimitRule
+}
+
+func NewRpcRateLimit(limiter ratelimit.Limiter, conf config.RateLimitConfiguration) *RpcRateLimit {
+	return &RpcRateLimit{limiter: limiter, enabled: conf.Enabled, rules: conf.Rules}
+}
+
+// Update applies Enabled and Rules from a reloaded configuration; the backend is kept
+func (r *RpcRateLimit) Update(conf config.RateLimitConfiguration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enabled = conf.Enabled
+	r.rules = conf.Rules
+}
+
+// Check returns an RpcError with code RateLimitedCode when the call exceeds a limit
+func (r *RpcRateLimit) Check(ctx context.Context, method, principal string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	enabled, rules := r.enabled, r.rules
+	r.mu.RUnlock()
+	if !enabled {
+		return nil
+	}
+	for _, scope := range []string{"", method} {
+		rule, ok := matchRule(rules, scope, principal)
+		if !ok || rule.Limit <= 0 || rule.Window <= 0 {
+			continue
+		}
+		key := "rpc:" + scope + ":" + hashPrincipal(principal)
+		allowed, retryAfter, err := r.limiter.Allow(ctx, key, rule.Limit, rule.Window)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return resp.NewError(resp.RateLimitedCode, "rate limit exceeded", map[string]any{
+				"retry_after": retryAfterSeconds(retryAfter),
+				"limit":       rule.Limit,
+				"window":      rule.Window.String(),
+				"method":      scope,
+			})
+		}
+	}
+	return nil
+}
+
+// Interceptor rejects calls over the limit before they reach the rest of the chain
+func (r *RpcRateLimit) Interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (interface{}, error) {
+			if err := r.Check(ctx, call.Name, call.Principal); err != nil {
+				return nil, err
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+func matchRule(rules []config.RateLimitRule, method, principal string) (config.RateLimitRule, bool) {
+	var generic *config.RateLimitRule
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Method != method {
+			continue
+		}
+		if rule.Principal == principal {
+			return *rule, true
+		}
+		if rule.Principal == "" && generic == nil {
+			generic = rule
+		}
+	}
+	if generic == nil {
+		return config.RateLimitRule{}, false
+	}
+	return *generic, true
+}
+
+// newRateLimiter picks the limiter backend configured in RateLimitConfiguration
+func newRateLimiter(conf config.RateLimitConfiguration, storage *storage.Storage) ratelimit.Limiter {
+	if conf.Backend == "redis" && storage != nil && storage.GetRedis() != nil {
+		return ratelimit.NewRedisLimiter(storage.GetRedis())
+	}
+	return ratelimit.NewMemoryLimiter()
+}
+
+// setRetryAfter sets the Retry-After header from the data of a rate limit error
+func setRetryAfter(ctx *gin.Context, err *resp.RpcError) {
+	if data, ok := err.Data.(map[string]any); ok {
+		if seconds, ok := data["retry_after"].(int); ok {
+			ctx.Header("Retry-After", strconv.Itoa(seconds))
+		}
+	}
+}
+
+// hashPrincipal keeps raw API keys out of limiter keys
+func hashPrincipal(principal string) string {
+	sum := sha256.Sum256([]byte(principal))
+	return hex.EncodeToString(sum[:16])
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
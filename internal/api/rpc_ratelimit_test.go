@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/google/feitian/pkg/common/ratelimit"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+func TestMatchRule(t *testing.T) {
+	rules := []config.RateLimitRule{
+		{Limit: 100, Window: time.Minute},
+		{Principal: "key:vip", Limit: 1000, Window: time.Minute},
+		{Method: "echo", Limit: 10, Window: time.Minute},
+		{Method: "echo", Principal: "ip:192.0.2.7", Limit: 1, Window: time.Minute},
+	}
+	tests := []struct {
+		name      string
+		method    string
+		principal string
+		wantLimit int
+		wantOk    bool
+	}{
+		{"generic rule for all methods", "", "ip:198.51.100.1", 100, true},
+		{"principal rule wins", "", "key:vip", 1000, true},
+		{"method rule", "echo", "key:vip", 10, true},
+		{"method and principal rule", "echo", "ip:192.0.2.7", 1, true},
+		{"no rule for method", "ping", "key:vip", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := matchRule(rules, tt.method, tt.principal)
+			if ok != tt.wantOk || rule.Limit != tt.wantLimit {
+				t.Errorf("matchRule = %d, %v; want %d, %v", rule.Limit, ok, tt.wantLimit, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestRpcRateLimitCheck(t *testing.T) {
+	conf := config.RateLimitConfiguration{
+		Enabled: true,
+		Rules: []config.RateLimitRule{
+			{Limit: 3, Window: time.Minute},
+			{Method: "echo", Limit: 1, Window: time.Minute},
+		},
+	}
+	r := NewRpcRateLimit(ratelimit.NewMemoryLimiter(), conf)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		method    string
+		principal string
+		limited   bool
+	}{
+		{"first echo", "echo", "ip:a", false},
+		{"second echo hits the method limit", "echo", "ip:a", true},
+		{"other method still allowed", "ping", "ip:a", false},
+		{"other principal has its own budget", "echo", "ip:b", false},
+		{"global limit reached", "ping", "ip:a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Check(ctx, tt.method, tt.principal)
+			var rpcErr *resp.RpcError
+			limited := errors.As(err, &rpcErr) && rpcErr.Code == resp.RateLimitedCode
+			if limited != tt.limited {
+				t.Fatalf("Check = %v, want limited = %v", err, tt.limited)
+			}
+			if limited {
+				data := rpcErr.Data.(map[string]any)
+				if seconds, _ := data["retry_after"].(int); seconds < 1 {
+					t.Errorf("retry_after = %v, want at least 1", data["retry_after"])
+				}
+			}
+		})
+	}
+}
+
+func TestRpcRateLimitUpdate(t *testing.T) {
+	r := NewRpcRateLimit(ratelimit.NewMemoryLimiter(), config.RateLimitConfiguration{
+		Rules: []config.RateLimitRule{{Limit: 1, Window: time.Minute}},
+	})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := r.Check(ctx, "ping", "ip:a"); err != nil {
+			t.Fatalf("disabled limiter rejected call %d: %v", i+1, err)
+		}
+	}
+	r.Update(config.RateLimitConfiguration{Enabled: true, Rules: []config.RateLimitRule{{Limit: 1, Window: time.Minute}}})
+	if err := r.Check(ctx, "ping", "ip:a"); err != nil {
+		t.Fatalf("first call after enabling: %v", err)
+	}
+	if err := r.Check(ctx, "ping", "ip:a"); err == nil {
+		t.Fatal("second call after enabling was not limited")
+	}
+}
+
+func TestHashPrincipalHidesKey(t *testing.T) {
+	hashed := hashPrincipal("key:secret")
+	if len(hashed) != 32 || hashed == hashPrincipal("key:other") {
+		t.Errorf("hashPrincipal = %q", hashed)
+	}
+}
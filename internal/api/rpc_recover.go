@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+
+	"github.com/google/feitian/internal/middleware"
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/rs/zerolog/log"
+)
+
+// SetPanicReporter sets where panics of RPC methods are reported; they are logged either way
+func (h *RpcHandler) SetPanicReporter(reporter middleware.PanicReporter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.panics = reporter
+}
+
+// recovered logs and reports a panic of call and returns the error it fails with. Only the
+// call fails: the other calls of a batch still run, and the response keeps the request id.
+// It runs on the goroutine that panicked, so the report is sent even after the deadline; by then
+// the HTTP request may be gone, hence path and the call's ctx instead of call.Request.
+func (h *RpcHandler) recovered(ctx context.Context, path string, call *Call, value interface{}, stack []byte) error {
+	event := middleware.NewPanicEvent(value, stack)
+	event.Path = path
+	event.Method = call.Name
+	event.RequestId = call.Id
+	log.Error().Str("method", event.Method).Str("id", event.RequestId).Str("panic", event.Value).
+		Str("stack", event.Stack).Msg("Recovered from panic in RPC method")
+
+	h.mu.RLock()
+	reporter := h.panics
+	h.mu.RUnlock()
+	if reporter != nil {
+		reporter.ReportPanic(context.WithoutCancel(ctx), event)
+	}
+	return resp.NewError(resp.InternalErrorCode, "internal error", nil)
+}
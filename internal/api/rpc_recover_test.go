@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/feitian/internal/middleware"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// panicRecorder keeps the panic events it receives
+type panicRecorder struct {
+	mu     sync.Mutex
+	events []middleware.PanicEvent
+}
+
+func (r *panicRecorder) ReportPanic(_ context.Context, event middleware.PanicEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestBatchPanic(t *testing.T) {
+	h := NewRpcHandler()
+	reporter := &panicRecorder{}
+	h.SetPanicReporter(reporter)
+	h.RegisterMethod(&TypedMethod[struct{}, string]{MethodName: "explode", Handler: func(ctx context.Context, _ struct{}) (string, error) {
+		panic("boom")
+	}})
+	h.RegisterMethod(&TypedMethod[struct{}, string]{MethodName: "ok", Handler: func(ctx context.Context, _ struct{}) (string, error) {
+		return "fine", nil
+	}})
+
+	w := postRpc(h, `[
+		{"jsonrpc":"2.0","id":"1","method":"ok"},
+		{"jsonrpc":"2.0","id":"2","method":"explode"},
+		{"jsonrpc":"2.0","id":"3","method":"ok"}
+	]`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var responses []resp.RpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil || len(responses) != 3 {
+		t.Fatalf("body = %s, want three responses", w.Body)
+	}
+	for _, response := range responses {
+		switch response.Id {
+		case "2":
+			if response.Error == nil || response.Error.Code != resp.InternalErrorCode {
+				t.Errorf("panicking call: error %+v, want code %d", response.Error, resp.InternalErrorCode)
+			}
+		default:
+			if response.Error != nil || string(response.Result) != `"fine"` {
+				t.Errorf("call %s: result %s, error %+v; want it unaffected by the panic", response.Id, response.Result, response.Error)
+			}
+		}
+	}
+
+	if len(reporter.events) != 1 {
+		t.Fatalf("reported %d events, want 1", len(reporter.events))
+	}
+	event := reporter.events[0]
+	if event.Value != "boom" || event.Method != "explode" || event.RequestId != "2" || event.Path != "/api/rpc" || event.Stack == "" {
+		t.Errorf("event = %+v", event)
+	}
+}
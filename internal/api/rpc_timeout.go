@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// timeoutHeader lets the client shorten the deadline of its request, as a Go duration
+// ("1500ms", "2s") or a number of milliseconds. It can never extend the server's timeout.
+const timeoutHeader = "X-Request-Timeout"
+
+// TimeoutMethod is an RpcMethod with its own deadline instead of RpcConfiguration.DefaultTimeout
+
+type TimeoutMethod interface {
+	RpcMethod
+	Timeout() time.Duration
+}
+
+// SetDefaultTimeout bounds every call of a method that does not implement TimeoutMethod; 0 disables it
+func (h *RpcHandler) SetDefaultTimeout(timeout time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.defaultTimeout = timeout
+}
+
+func (h *RpcHandler) methodTimeout(method RpcMethod) time.Duration {
+	if m, ok := method.(TimeoutMethod); ok {
+		return m.Timeout()
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.defaultTimeout
+}
+
+// invoke runs the interceptor chain under the call's deadline. The chain runs in its own goroutine
+// so that a method ignoring ctx cannot hold the response past the deadline; a panic fails the call
+// only (see recovered).
+func (h *RpcHandler) invoke(ctx *gin.Context, call *Call) (interface{}, error) {
+	callCtx, cancel := context.WithCancel(ctx.Request.Context())
+	timeout := h.methodTimeout(call.Method)
+	if timeout > 0 {
+		cancel()
+		callCtx, cancel = context.WithTimeout(ctx.Request.Context(), timeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	path := ctx.Request.URL.Path
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: h.recovered(callCtx, path, call, r, debug.Stack())}
+			}
+		}()
+		result, err := h.chain(call.Name)(callCtx, call)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil && callCtx.Err() != nil && errors.Is(o.err, callCtx.Err()) {
+			return nil, contextError(callCtx)
+		}
+		return o.result, o.err
+	case <-callCtx.Done():
+		return nil, contextError(callCtx)
+	}
+}
+
+// contextError reports why ctx ended: its deadline passed, or the client went away
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return resp.NewError(resp.TimeoutCode, "request timed out", nil)
+	}
+	return resp.NewError(resp.ServerErrorCode, "request cancelled", nil)
+}
+
+// withClientDeadline applies the timeout header to the request context
+func withClientDeadline(ctx *gin.Context) (context.CancelFunc, error) {
+	value := ctx.GetHeader(timeoutHeader)
+	if value == "" {
+		return func() {}, nil
+	}
+	timeout, err := parseTimeout(value)
+	if err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+	ctx.Request = ctx.Request.WithContext(reqCtx)
+	return cancel, nil
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		ms, msErr := strconv.ParseInt(value, 10, 64)
+		if msErr != nil {
+			return 0, fmt.Errorf("invalid %s header: %q", timeoutHeader, value)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s header: %q", timeoutHeader, value)
+	}
+	return timeout, nil
+}
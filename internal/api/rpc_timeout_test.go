@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// timedMethod is a TypedMethod with its own timeout
+type timedMethod struct {
+	TypedMethod[struct{}, string]
+	timeout time.Duration
+}
+
+func (m *timedMethod) Timeout() time.Duration { return m.timeout }
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"1500ms", 1500 * time.Millisecond, false},
+		{"2s", 2 * time.Second, false},
+		{"250", 250 * time.Millisecond, false},
+		{"0", 0, true},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTimeout(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseTimeout = %v, %v; want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	waitCtx := func(ctx context.Context, _ struct{}) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	// ignoreCtx stands for a method stuck in a call that does not take ctx
+	ignoreCtx := func(ctx context.Context, _ struct{}) (string, error) {
+		<-release
+		return "late", nil
+	}
+	fast := func(ctx context.Context, _ struct{}) (string, error) { return "ok", nil }
+
+	tests := []struct {
+		name           string
+		defaultTimeout time.Duration
+		methodTimeout  time.Duration // 0: the method does not implement TimeoutMethod
+		header         string
+		handler        func(ctx context.Context, _ struct{}) (string, error)
+		wantStatus     int
+		wantCode       int
+	}{
+		{"default timeout", 50 * time.Millisecond, 0, "", waitCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"method timeout overrides the default", time.Hour, 50 * time.Millisecond, "", waitCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"header shortens the deadline", time.Hour, 0, "50ms", waitCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"header in milliseconds", time.Hour, time.Hour, "50", waitCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"header cannot extend the deadline", 0, 50 * time.Millisecond, "1h", waitCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"method ignoring ctx", 50 * time.Millisecond, 0, "", ignoreCtx, http.StatusGatewayTimeout, resp.TimeoutCode},
+		{"within the deadline", 50 * time.Millisecond, 0, "", fast, http.StatusOK, 0},
+		{"no timeout", 0, 0, "", fast, http.StatusOK, 0},
+		{"invalid header", time.Hour, 0, "soon", fast, http.StatusBadRequest, resp.InvalidRequestCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRpcHandler()
+			h.SetDefaultTimeout(tt.defaultTimeout)
+			method := TypedMethod[struct{}, string]{MethodName: "m", Handler: tt.handler}
+			if tt.methodTimeout > 0 {
+				h.RegisterMethod(&timedMethod{TypedMethod: method, timeout: tt.methodTimeout})
+			} else {
+				h.RegisterMethod(&method)
+			}
+			headers := map[string]string{}
+			if tt.header != "" {
+				headers[timeoutHeader] = tt.header
+			}
+
+			start := time.Now()
+			w := postRpc(h, `{"jsonrpc":"2.0","id":"1","method":"m"}`, headers)
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("response took %v, want it at the deadline", elapsed)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			response := decodeResponse(t, w)
+			switch {
+			case tt.wantCode == 0 && response.Error != nil:
+				t.Errorf("error %+v, want a result", response.Error)
+			case tt.wantCode != 0 && (response.Error == nil || response.Error.Code != tt.wantCode):
+				t.Errorf("error %+v, want code %d", response.Error, tt.wantCode)
+			}
+			if tt.wantCode == resp.TimeoutCode && response.Id != "1" {
+				t.Errorf("id = %q, want the request id", response.Id)
+			}
+		})
+	}
+}
+
+func TestClientCancellation(t *testing.T) {
+	h := NewRpcHandler()
+	h.SetDefaultTimeout(time.Hour)
+	seen := make(chan error, 1)
+	h.RegisterMethod(&TypedMethod[struct{}, string]{MethodName: "m", Handler: func(ctx context.Context, _ struct{}) (string, error) {
+		<-ctx.Done()
+		seen <- ctx.Err()
+		return "", ctx.Err()
+	}})
+
+	router := gin.New()
+	router.POST("/api/rpc", h.HandleRpcRequest)
+	reqCtx, disconnect := context.WithCancel(context.Background())
+	req := httptest.NewRequest("POST", "/api/rpc", strings.NewReader(`{"jsonrpc":"2.0","id":"1","method":"m"}`)).WithContext(reqCtx)
+	time.AfterFunc(50*time.Millisecond, disconnect)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if err := <-seen; !errors.Is(err, context.Canceled) {
+		t.Errorf("method saw %v, want context.Canceled", err)
+	}
+	if response := decodeResponse(t, w); response.Error == nil || response.Error.Code != resp.ServerErrorCode || response.Error.Message != "request cancelled" {
+		t.Errorf("error %+v, want the call reported as cancelled rather than timed out", response.Error)
+	}
+}
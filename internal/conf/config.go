@@ -3,8 +3,17 @@ package conf
 import "github.com/google/feitian/pkg/common/config"
 
 type Config struct {
-	ServiceConfiguration  config.ServiceConfiguration  `mapstructure:"ServiceConfiguration"`
-	PostgresConfiguration config.PostgresConfiguration `mapstructure:"PostgresConfiguration"`
-	RedisConfiguration    config.RedisConfiguration    `mapstructure:"RedisConfiguration"`
-	LoggerConfiguration   config.LoggerConfig          `mapstructure:"LoggerConfiguration"`
+	ServiceConfiguration     config.ServiceConfiguration     `mapstructure:"ServiceConfiguration"`
+	PostgresConfiguration    config.PostgresConfiguration    `mapstructure:"PostgresConfiguration"`
+	RedisConfiguration       config.RedisConfiguration       `mapstructure:"RedisConfiguration"`
+	LoggerConfiguration      config.LoggerConfig             `mapstructure:"LoggerConfiguration"`
+	AuthConfiguration        config.AuthConfiguration        `mapstructure:"AuthConfiguration"`
+	RateLimitConfiguration   config.RateLimitConfiguration   `mapstructure:"RateLimitConfiguration"`
+	JobsConfiguration        config.JobsConfiguration        `mapstructure:"JobsConfiguration"`
+	SchedulerConfiguration   config.SchedulerConfiguration   `mapstructure:"SchedulerConfiguration"`
+	RpcConfiguration         config.RpcConfiguration         `mapstructure:"RpcConfiguration"`
+	CorsConfiguration        config.CorsConfiguration        `mapstructure:"CorsConfiguration"`
+	SecurityConfiguration    config.SecurityConfiguration    `mapstructure:"SecurityConfiguration"`
+	CsrfConfiguration        config.CsrfConfiguration        `mapstructure:"CsrfConfiguration"`
+	CompressionConfiguration config.CompressionConfiguration `mapstructure:"CompressionConfiguration"`
 }
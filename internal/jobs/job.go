@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrDuplicateJob = errors.New("a job with the same unique key is already pending")
+	ErrNoHandler    = errors.New("no handler registered for job type")
+)
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the job goes straight to the dead-letter queue without retries
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Job is a unit of background work as stored in the queue
+
+type Job struct {
+	Id         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	MaxRetries int             `json:"max_retries"`
+	UniqueKey  string          `json:"unique_key,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	RunAt      time.Time       `json:"run_at"`
+}
+
+// JobHandler processes jobs of one type, the way RpcMethod serves one method
+// Name: job type; Handle: business logic, a returned error schedules a retry. ctx is cancelled after
+// JobsConfiguration.JobTimeout and when the worker shuts down.
+
+type JobHandler interface {
+	Name() string
+	Handle(ctx context.Context, job *Job) error
+}
+
+// EnqueueOptions tune a single enqueue call
+// Delay: run no earlier than now+Delay; MaxRetries: overrides the configured default (-1 disables retries);
+// UniqueKey: while a job with the same key is pending, further enqueues return ErrDuplicateJob.
+
+type EnqueueOptions struct {
+	Delay      time.Duration
+	MaxRetries int
+	UniqueKey  string
+}
+
+// typedHandler decodes the payload into T before calling fn
+
+type typedHandler[T any] struct {
+	name string
+	fn   func(ctx context.Context, payload T) error
+}
+
+// NewHandler builds a JobHandler whose payload is decoded into T
+func NewHandler[T any](name string, fn func(ctx context.Context, payload T) error) JobHandler {
+	return &typedHandler[T]{name: name, fn: fn}
+}
+
+func (h *typedHandler[T]) Name() string { return h.name }
+
+func (h *typedHandler[T]) Handle(ctx context.Context, job *Job) error {
+	var payload T
+	if len(job.Payload) > 0 {
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("invalid payload for job %s: %w", h.name, err))
+		}
+	}
+	return h.fn(ctx, payload)
+}
@@ -0,0 +1,358 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Redis layout:
+//
+//	jobs:data            hash  id -> job JSON, for pending and running jobs
+//	jobs:scheduled       zset  id scored by run-at (ms); immediate jobs are due now
+//	jobs:inflight        zset  id scored by visibility deadline (ms); expired entries are re-queued
+//	jobs:dead            list  ids of jobs that exhausted their retries
+//	jobs:dead:data:<id>  job JSON of a dead job, expiring after DeadTTL
+//	jobs:unique:<k>      id of the pending job holding unique key k
+const (
+	keyData      = "jobs:data"
+	keyScheduled = "jobs:scheduled"
+	keyInflight  = "jobs:inflight"
+	keyDead      = "jobs:dead"
+	keyDeadData  = "jobs:dead:data:"
+	keyUnique    = "jobs:unique:"
+)
+
+var (
+	// Ids whose data is gone (e.g. deleted by hand) are dropped instead of being marked in flight forever
+	dequeueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 10)
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[3], id)
+	if data then
+		redis.call('ZADD', KEYS[2], tonumber(ARGV[1]) + tonumber(ARGV[2]), id)
+		return data
+	end
+end
+return false
+`)
+	// Claims one expired job like dequeue does, so a reaper dying halfway leaves it to expire again
+	claimExpiredScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 10)
+for _, id in ipairs(ids) do
+	local data = redis.call('HGET', KEYS[2], id)
+	if data then
+		redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + tonumber(ARGV[2]), id)
+		return data
+	end
+	redis.call('ZREM', KEYS[1], id)
+end
+return false
+`)
+	// Dead jobs share one TTL and the list is newest first, so expired ids collect at its tail
+	pruneDeadScript = redis.NewScript(`
+local n = 0
+while n < tonumber(ARGV[2]) do
+	local id = redis.call('LINDEX', KEYS[1], -1)
+	if not id or redis.call('EXISTS', ARGV[1] .. id) == 1 then
+		break
+	end
+	redis.call('RPOP', KEYS[1])
+	n = n + 1
+end
+return n
+`)
+	releaseUniqueScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Queue stores jobs in Redis and dispatches them to registered handlers.
+// Jobs survive restarts: a job taken by a worker that dies is re-queued once
+// its visibility timeout expires.
+
+type Queue struct {
+	redis    *redis.Client
+	conf     config.JobsConfiguration
+	handlers map[string]JobHandler
+}
+
+func NewQueue(redisConn *redis.Client, conf config.JobsConfiguration) *Queue {
+	if conf.BackoffBase <= 0 {
+		conf.BackoffBase = time.Second
+	}
+	if conf.BackoffMax <= 0 {
+		conf.BackoffMax = time.Hour
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	if conf.VisibilityTimeout <= 0 {
+		conf.VisibilityTimeout = 5 * time.Minute
+	}
+	if conf.UniqueTTL <= 0 {
+		conf.UniqueTTL = 24 * time.Hour
+	}
+	if conf.DeadTTL <= 0 {
+		conf.DeadTTL = 7 * 24 * time.Hour
+	}
+	return &Queue{redis: redisConn, conf: conf, handlers: make(map[string]JobHandler)}
+}
+
+// RegisterHandler registers the handler for its job type; call it before Run
+func (q *Queue) RegisterHandler(handler JobHandler) {
+	q.handlers[handler.Name()] = handler
+}
+
+// Enqueue stores a job of the given type and returns its id
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts EnqueueOptions) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	id, err := newJobId()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	job := Job{
+		Id:         id,
+		Type:       jobType,
+		Payload:    data,
+		MaxRetries: q.conf.MaxRetries,
+		UniqueKey:  opts.UniqueKey,
+		CreatedAt:  now,
+		RunAt:      now.Add(opts.Delay),
+	}
+	switch {
+	case opts.MaxRetries < 0:
+		job.MaxRetries = 0
+	case opts.MaxRetries > 0:
+		job.MaxRetries = opts.MaxRetries
+	}
+
+	if job.UniqueKey != "" {
+		ok, err := q.redis.SetNX(ctx, keyUnique+job.UniqueKey, id, q.conf.UniqueTTL).Result()
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrDuplicateJob
+		}
+	}
+
+	raw, err := json.Marshal(job)
+	if err != nil {
+		_ = q.releaseUnique(ctx, &job)
+		return "", err
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, keyData, id, raw)
+		pipe.ZAdd(ctx, keyScheduled, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: id})
+		return nil
+	})
+	if err != nil {
+		_ = q.releaseUnique(ctx, &job)
+		return "", err
+	}
+	return id, nil
+}
+
+// DeadJobs returns up to limit jobs from the dead-letter queue, newest first.
+// Jobs whose data expired after DeadTTL are dropped from the queue.
+func (q *Queue) DeadJobs(ctx context.Context, limit int64) ([]*Job, error) {
+	if _, err := q.pruneDead(ctx); err != nil {
+		return nil, err
+	}
+	ids, err := q.redis.LRange(ctx, keyDead, 0, limit-1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = keyDeadData + id
+	}
+	raws, err := q.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(raws))
+	for i, raw := range raws {
+		s, ok := raw.(string)
+		if !ok {
+			if err := q.redis.LRem(ctx, keyDead, 1, ids[i]).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(s), &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// RetryDead moves a job from the dead-letter queue back to the queue with a fresh retry budget
+func (q *Queue) RetryDead(ctx context.Context, id string) error {
+	removed, err := q.redis.LRem(ctx, keyDead, 1, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errors.New("job is not in the dead-letter queue")
+	}
+	raw, err := q.redis.Get(ctx, keyDeadData+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return errors.New("dead job expired")
+	}
+	if err != nil {
+		return err
+	}
+	var job Job
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return err
+	}
+	job.Attempts = 0
+	job.RunAt = time.Now()
+	if err := q.schedule(ctx, &job); err != nil {
+		return err
+	}
+	return q.redis.Del(ctx, keyDeadData+id).Err()
+}
+
+// dequeue takes the next due job and marks it in flight, or returns nil when none is due
+func (q *Queue) dequeue(ctx context.Context) (*Job, error) {
+	now := time.Now().UnixMilli()
+	raw, err := dequeueScript.Run(ctx, q.redis, []string{keyScheduled, keyInflight, keyData}, now, q.conf.VisibilityTimeout.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// extend pushes the visibility deadline of a running job forward
+func (q *Queue) extend(ctx context.Context, id string) error {
+	deadline := time.Now().Add(q.conf.VisibilityTimeout).UnixMilli()
+	return q.redis.ZAddXX(ctx, keyInflight, redis.Z{Score: float64(deadline), Member: id}).Err()
+}
+
+// ack removes a finished job
+func (q *Queue) ack(ctx context.Context, job *Job) error {
+	_, err := q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, keyInflight, job.Id)
+		pipe.HDel(ctx, keyData, job.Id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return q.releaseUnique(ctx, job)
+}
+
+// schedule stores the job and puts it back on the queue at job.RunAt
+func (q *Queue) schedule(ctx context.Context, job *Job) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, keyData, job.Id, raw)
+		pipe.ZRem(ctx, keyInflight, job.Id)
+		pipe.ZAdd(ctx, keyScheduled, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.Id})
+		return nil
+	})
+	return err
+}
+
+// bury moves the job to the dead-letter queue
+func (q *Queue) bury(ctx context.Context, job *Job) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, keyDeadData+job.Id, raw, q.conf.DeadTTL)
+		pipe.HDel(ctx, keyData, job.Id)
+		pipe.ZRem(ctx, keyInflight, job.Id)
+		pipe.LPush(ctx, keyDead, job.Id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return q.releaseUnique(ctx, job)
+}
+
+func (q *Queue) releaseUnique(ctx context.Context, job *Job) error {
+	if job.UniqueKey == "" {
+		return nil
+	}
+	return releaseUniqueScript.Run(ctx, q.redis, []string{keyUnique + job.UniqueKey}, job.Id).Err()
+}
+
+// requeueExpired returns up to 100 jobs whose worker stopped heartbeating to the queue.
+// An expiry counts as a failed attempt, so a job that keeps crashing or hanging its worker
+// ends up in the dead-letter queue like one that keeps returning errors.
+func (q *Queue) requeueExpired(ctx context.Context) (int, error) {
+	n := 0
+	for ; n < 100; n++ {
+		now := time.Now().UnixMilli()
+		raw, err := claimExpiredScript.Run(ctx, q.redis, []string{keyInflight, keyData}, now, q.conf.VisibilityTimeout.Milliseconds()).Text()
+		if errors.Is(err, redis.Nil) {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(raw), &job); err != nil {
+			return n, err
+		}
+		job.Attempts++
+		job.LastError = "worker stopped before the job finished"
+		if job.Attempts > job.MaxRetries {
+			log.Error().Str("job_id", job.Id).Str("job_type", job.Type).Int("attempts", job.Attempts).Msg("expired job moved to dead-letter queue")
+			err = q.bury(ctx, &job)
+		} else {
+			job.RunAt = time.Now().Add(q.backoff(job.Attempts))
+			err = q.schedule(ctx, &job)
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// pruneDead drops up to 100 ids whose dead job data expired from the tail of the dead-letter queue
+func (q *Queue) pruneDead(ctx context.Context) (int, error) {
+	return pruneDeadScript.Run(ctx, q.redis, []string{keyDead}, keyDeadData, 100).Int()
+}
+
+func newJobId() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,329 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestQueue(t *testing.T, conf config.JobsConfiguration) (*Queue, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewQueue(client, conf), mr
+}
+
+// takeJob enqueues a job of type "test" and dequeues it like a worker would
+func takeJob(t *testing.T, q *Queue, opts EnqueueOptions) *Job {
+	t.Helper()
+	ctx := context.Background()
+	id, err := q.Enqueue(ctx, "test", map[string]string{"k": "v"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.dequeue(ctx)
+	if err != nil || job == nil || job.Id != id {
+		t.Fatalf("dequeue = %+v, %v; want job %s", job, err, id)
+	}
+	return job
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	q, _ := newTestQueue(t, config.JobsConfiguration{})
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{UniqueKey: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{UniqueKey: "u1"}); !errors.Is(err, ErrDuplicateJob) {
+		t.Fatalf("second Enqueue error = %v, want ErrDuplicateJob", err)
+	}
+	if _, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{UniqueKey: "u2"}); err != nil {
+		t.Fatalf("Enqueue with another key: %v", err)
+	}
+
+	// The key is released once the job is done
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ struct{}) error { return nil }))
+	job, err := q.dequeue(ctx)
+	if err != nil || job == nil {
+		t.Fatalf("dequeue = %v, %v", job, err)
+	}
+	q.process(ctx, job)
+	if _, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{UniqueKey: job.UniqueKey}); err != nil {
+		t.Errorf("Enqueue after the job finished: %v", err)
+	}
+}
+
+func TestDequeue(t *testing.T) {
+	q, mr := newTestQueue(t, config.JobsConfiguration{})
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{Delay: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := q.dequeue(ctx); job != nil || err != nil {
+		t.Fatalf("dequeue = %+v, %v; want nothing before the delay", job, err)
+	}
+
+	// An id whose data was deleted is dropped rather than blocking the jobs behind it
+	mr.ZAdd(keyScheduled, 0, "orphan")
+	id, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.dequeue(ctx)
+	if err != nil || job == nil || job.Id != id {
+		t.Fatalf("dequeue = %+v, %v; want job %s", job, err, id)
+	}
+	if members, _ := mr.ZMembers(keyScheduled); len(members) != 1 {
+		t.Errorf("scheduled = %v, want only the delayed job", members)
+	}
+	if members, _ := mr.ZMembers(keyInflight); len(members) != 1 || members[0] != id {
+		t.Errorf("in flight = %v, want [%s]", members, id)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	errFail := errors.New("boom")
+	tests := []struct {
+		name         string
+		maxRetries   int
+		attempts     int
+		err          error
+		wantState    string // "acked", "scheduled" or "dead"
+		wantAttempts int
+	}{
+		{"success", 3, 0, nil, "acked", 0},
+		{"failure is retried", 3, 0, errFail, "scheduled", 1},
+		{"last retry", 3, 3, errFail, "dead", 4},
+		{"permanent failure", 3, 0, Permanent(errFail), "dead", 1},
+		{"retries disabled", -1, 0, errFail, "dead", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, mr := newTestQueue(t, config.JobsConfiguration{DeadTTL: time.Hour})
+			q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ map[string]string) error { return tt.err }))
+			job := takeJob(t, q, EnqueueOptions{MaxRetries: tt.maxRetries})
+			job.Attempts = tt.attempts
+			q.process(context.Background(), job)
+
+			if members, _ := mr.ZMembers(keyInflight); len(members) != 0 {
+				t.Errorf("job still in flight")
+			}
+			scheduled, _ := mr.ZMembers(keyScheduled)
+			dead, _ := mr.List(keyDead)
+			inData := mr.HGet(keyData, job.Id) != ""
+			switch tt.wantState {
+			case "acked":
+				if len(scheduled) != 0 || len(dead) != 0 || inData {
+					t.Errorf("scheduled %v, dead %v, data kept %v; want the job gone", scheduled, dead, inData)
+				}
+			case "scheduled":
+				if len(scheduled) != 1 || !inData {
+					t.Errorf("scheduled %v, data kept %v; want the job scheduled", scheduled, inData)
+				}
+			case "dead":
+				if len(dead) != 1 || inData || len(scheduled) != 0 {
+					t.Errorf("dead %v, scheduled %v, data kept %v; want the job buried", dead, scheduled, inData)
+				}
+				if ttl := mr.TTL(keyDeadData + job.Id); ttl != time.Hour {
+					t.Errorf("dead job TTL = %v, want DeadTTL", ttl)
+				}
+			}
+			if job.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", job.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	q, mr := newTestQueue(t, config.JobsConfiguration{VisibilityTimeout: time.Second, JobTimeout: time.Minute})
+
+	var deadline time.Time
+	var hasDeadline bool
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ struct{}) error {
+		deadline, hasDeadline = ctx.Deadline()
+		return nil
+	}))
+	job := takeJob(t, q, EnqueueOptions{})
+	q.process(context.Background(), job)
+	if until := time.Until(deadline); until <= time.Second || until > time.Minute {
+		t.Errorf("job deadline in %v, want JobTimeout rather than the visibility timeout", until)
+	}
+
+	// Jobs outlive the visibility timeout through the heartbeat
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ struct{}) error {
+		time.Sleep(1500 * time.Millisecond)
+		return ctx.Err()
+	}))
+	job = takeJob(t, q, EnqueueOptions{})
+	if n, err := q.requeueExpired(context.Background()); err != nil || n != 0 {
+		t.Fatalf("requeueExpired = %d, %v; want nothing expired yet", n, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		q.process(context.Background(), job)
+		close(done)
+	}()
+	time.Sleep(1200 * time.Millisecond)
+	if n, err := q.requeueExpired(context.Background()); err != nil || n != 0 {
+		t.Errorf("requeueExpired = %d, %v; want the running job kept", n, err)
+	}
+	<-done
+	if mr.HGet(keyData, job.Id) != "" {
+		t.Errorf("long job was not acked")
+	}
+
+	q.conf.JobTimeout = 0
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ struct{}) error {
+		_, hasDeadline = ctx.Deadline()
+		return nil
+	}))
+	q.process(context.Background(), takeJob(t, q, EnqueueOptions{}))
+	if hasDeadline {
+		t.Error("job has a deadline with JobTimeout disabled")
+	}
+
+	// A job cancelled by worker shutdown goes back to the queue without using up an attempt
+	worker, stop := context.WithCancel(context.Background())
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ struct{}) error {
+		stop()
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	job = takeJob(t, q, EnqueueOptions{})
+	q.process(worker, job)
+	if job.Attempts != 0 {
+		t.Errorf("attempts = %d after shutdown, want 0", job.Attempts)
+	}
+	if scheduled, _ := mr.ZMembers(keyScheduled); len(scheduled) != 1 || scheduled[0] != job.Id {
+		t.Errorf("scheduled = %v, want the interrupted job", scheduled)
+	}
+}
+
+func TestDeadJobs(t *testing.T) {
+	q, mr := newTestQueue(t, config.JobsConfiguration{DeadTTL: time.Hour})
+	ctx := context.Background()
+	q.RegisterHandler(NewHandler("test", func(ctx context.Context, _ map[string]string) error {
+		return Permanent(errors.New("boom"))
+	}))
+	first := takeJob(t, q, EnqueueOptions{})
+	q.process(ctx, first)
+	mr.FastForward(30 * time.Minute)
+	second := takeJob(t, q, EnqueueOptions{})
+	q.process(ctx, second)
+
+	dead, err := q.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 2 || dead[0].Id != second.Id || dead[0].LastError != "boom" {
+		t.Fatalf("DeadJobs = %+v, %v; want both jobs, newest first", dead, err)
+	}
+
+	// Expired jobs are dropped from the list
+	mr.FastForward(45 * time.Minute)
+	dead, err = q.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].Id != second.Id {
+		t.Fatalf("DeadJobs = %+v, %v; want only the job within DeadTTL", dead, err)
+	}
+	if ids, _ := mr.List(keyDead); len(ids) != 1 {
+		t.Errorf("dead list = %v, want the expired id removed", ids)
+	}
+	if err := q.RetryDead(ctx, first.Id); err == nil {
+		t.Error("RetryDead accepted an expired job")
+	}
+
+	if err := q.RetryDead(ctx, second.Id); err != nil {
+		t.Fatalf("RetryDead: %v", err)
+	}
+	if mr.Exists(keyDeadData + second.Id) {
+		t.Error("RetryDead kept the dead job data")
+	}
+	job, err := q.dequeue(ctx)
+	if err != nil || job == nil || job.Id != second.Id || job.Attempts != 0 {
+		t.Fatalf("dequeue = %+v, %v; want the retried job with a fresh budget", job, err)
+	}
+	if err := q.RetryDead(ctx, second.Id); err == nil {
+		t.Error("RetryDead accepted a job that is no longer dead")
+	}
+
+	// Expired ids beyond limit are pruned as well
+	third := takeJob(t, q, EnqueueOptions{})
+	q.process(ctx, third)
+	fourth := takeJob(t, q, EnqueueOptions{})
+	q.process(ctx, fourth)
+	mr.FastForward(2 * time.Hour)
+	fifth := takeJob(t, q, EnqueueOptions{})
+	q.process(ctx, fifth)
+	if dead, err := q.DeadJobs(ctx, 1); err != nil || len(dead) != 1 || dead[0].Id != fifth.Id {
+		t.Fatalf("DeadJobs = %+v, %v; want the newest job", dead, err)
+	}
+	if ids, _ := mr.List(keyDead); len(ids) != 1 || ids[0] != fifth.Id {
+		t.Errorf("dead list = %v, want the expired ids past the limit removed", ids)
+	}
+}
+
+func TestRequeueExpired(t *testing.T) {
+	q, mr := newTestQueue(t, config.JobsConfiguration{BackoffBase: time.Millisecond, BackoffMax: time.Millisecond, DeadTTL: time.Hour})
+	ctx := context.Background()
+	expire := func(id string) {
+		mr.ZAdd(keyInflight, float64(time.Now().Add(-time.Second).UnixMilli()), id)
+	}
+
+	// Each expiry uses up an attempt, until the job is buried like one that keeps failing
+	job := takeJob(t, q, EnqueueOptions{MaxRetries: 1})
+	for attempt := 1; attempt <= 2; attempt++ {
+		expire(job.Id)
+		n, err := q.requeueExpired(ctx)
+		if err != nil || n != 1 {
+			t.Fatalf("attempt %d: requeueExpired = %d, %v; want 1", attempt, n, err)
+		}
+		if attempt == 2 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+		again, err := q.dequeue(ctx)
+		if err != nil || again == nil || again.Id != job.Id || again.Attempts != attempt || again.LastError == "" {
+			t.Fatalf("dequeue = %+v, %v; want the requeued job after %d attempts", again, err, attempt)
+		}
+	}
+	if members, _ := mr.ZMembers(keyInflight); len(members) != 0 {
+		t.Errorf("in flight = %v, want the buried job removed", members)
+	}
+	dead, err := q.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].Id != job.Id || dead[0].Attempts != 2 {
+		t.Fatalf("DeadJobs = %+v, %v; want the job that expired past its retries", dead, err)
+	}
+
+	// Ids without data are dropped
+	mr.ZAdd(keyInflight, 0, "orphan")
+	if n, err := q.requeueExpired(ctx); err != nil || n != 0 {
+		t.Errorf("requeueExpired = %d, %v; want the orphan dropped", n, err)
+	}
+	if members, _ := mr.ZMembers(keyInflight); len(members) != 0 {
+		t.Errorf("in flight = %v, want it empty", members)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := NewQueue(nil, config.JobsConfiguration{BackoffBase: time.Second, BackoffMax: 10 * time.Second})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		got := q.backoff(tt.attempt)
+		if got < tt.want || got > tt.want+tt.want/5 {
+			t.Errorf("backoff(%d) = %v, want %v plus up to 20%%", tt.attempt, got, tt.want)
+		}
+	}
+}
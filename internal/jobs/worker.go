@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// outcomeTimeout bounds recording the outcome of a job, which happens after the worker ctx may be done
+const outcomeTimeout = 10 * time.Second
+
+// Run starts concurrency workers and blocks until ctx is cancelled and the
+// jobs being processed have finished
+func (q *Queue) Run(ctx context.Context, concurrency int) error {
+	if concurrency <= 0 {
+		return errors.New("jobs: worker concurrency must be positive")
+	}
+	var wg sync.WaitGroup
+	wg.Add(concurrency + 1)
+	go func() {
+		defer wg.Done()
+		q.reaper(ctx)
+	}()
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	log.Info().Int("workers", concurrency).Msg("Job workers started")
+	wg.Wait()
+	log.Info().Msg("Job workers stopped")
+	return nil
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := q.dequeue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to dequeue job")
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(q.conf.PollInterval):
+			}
+			continue
+		}
+		q.process(ctx, job)
+	}
+}
+
+// process runs one job under a context derived from the worker's, with JobTimeout as deadline.
+// The heartbeat keeps the job taken for as long as it runs. A job interrupted by worker shutdown
+// goes back to the queue without using up a retry.
+func (q *Queue) process(ctx context.Context, job *Job) {
+	logger := log.With().Str("job_id", job.Id).Str("job_type", job.Type).Logger()
+
+	var jobCtx context.Context
+	var cancel context.CancelFunc
+	if q.conf.JobTimeout > 0 {
+		jobCtx, cancel = context.WithTimeout(ctx, q.conf.JobTimeout)
+	} else {
+		jobCtx, cancel = context.WithCancel(ctx)
+	}
+	stop := q.heartbeat(job.Id)
+	err := q.handle(jobCtx, job)
+	stop()
+	cancel()
+
+	interrupted := err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled)
+	// Record the outcome even when the worker is stopping
+	ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), outcomeTimeout)
+	defer cancel()
+	if interrupted {
+		job.RunAt = time.Now()
+		logger.Info().Msg("job interrupted by shutdown, requeued")
+		if err := q.schedule(ctx, job); err != nil {
+			logger.Error().Err(err).Msg("failed to requeue job")
+		}
+		return
+	}
+
+	if err == nil {
+		if err := q.ack(ctx, job); err != nil {
+			logger.Error().Err(err).Msg("failed to ack job")
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if isPermanent(err) || job.Attempts > job.MaxRetries {
+		logger.Error().Err(err).Int("attempts", job.Attempts).Msg("job moved to dead-letter queue")
+		if err := q.bury(ctx, job); err != nil {
+			logger.Error().Err(err).Msg("failed to bury job")
+		}
+		return
+	}
+	job.RunAt = time.Now().Add(q.backoff(job.Attempts))
+	logger.Warn().Err(err).Int("attempts", job.Attempts).Time("retry_at", job.RunAt).Msg("job failed, retrying")
+	if err := q.schedule(ctx, job); err != nil {
+		logger.Error().Err(err).Msg("failed to reschedule job")
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, job *Job) (err error) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, job.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Str("job_id", job.Id).Msgf("job panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler.Handle(ctx, job)
+}
+
+// heartbeat keeps the job invisible to other workers while it runs
+func (q *Queue) heartbeat(id string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.conf.VisibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.extend(context.Background(), id); err != nil {
+					log.Warn().Err(err).Str("job_id", id).Msg("failed to extend job visibility")
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// reaper periodically re-queues jobs whose worker disappeared and prunes expired dead jobs
+func (q *Queue) reaper(ctx context.Context) {
+	ticker := time.NewTicker(q.conf.VisibilityTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := q.requeueExpired(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("failed to requeue expired jobs")
+			}
+			if n > 0 {
+				log.Warn().Int("jobs", n).Msg("requeued jobs whose worker stopped")
+			}
+			if _, err := q.pruneDead(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("failed to prune dead jobs")
+			}
+		}
+	}
+}
+
+// backoff returns BackoffBase * 2^(attempt-1), capped at BackoffMax, with up to 20% jitter
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.conf.BackoffBase
+	for i := 1; i < attempt && d < q.conf.BackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, q.conf.BackoffMax)
+	return d + rand.N(d/5+1)
+}
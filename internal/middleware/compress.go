@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/google/feitian/pkg/common/resp"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMaxWindow is the largest zstd window accepted in request bodies
+const zstdMaxWindow = 8 << 20
+
+// Compression compresses responses and decompresses request bodies according to a
+// config.CompressionConfiguration. "deflate" is the zlib format, as HTTP defines it;
+// "zstd" is Zstandard (RFC 8878). Update replaces the settings at runtime.
+type Compression struct {
+	mu       sync.RWMutex
+	settings *compressionSettings
+}
+
+type compressionSettings struct {
+	enabled   bool
+	minSize   int
+	encodings []string
+	// writers are pooled per encoding: a compressor allocates hundreds of KB
+	pools map[string]*sync.Pool
+}
+
+func NewCompression(conf config.CompressionConfiguration) *Compression {
+	c := &Compression{}
+	c.Update(conf)
+	return c
+}
+
+// Update applies a reloaded configuration
+func (c *Compression) Update(conf config.CompressionConfiguration) {
+	settings := &compressionSettings{
+		enabled:   conf.Enabled,
+		minSize:   conf.MinSize,
+		encodings: conf.Encodings,
+		pools:     make(map[string]*sync.Pool),
+	}
+	level := conf.Level
+	for _, encoding := range conf.Encodings {
+		var newWriter func() interface{}
+		switch encoding {
+		case "gzip":
+			newWriter = func() interface{} { w, _ := gzip.NewWriterLevel(io.Discard, level); return w }
+		case "deflate":
+			newWriter = func() interface{} { w, _ := zlib.NewWriterLevel(io.Discard, level); return w }
+		case "zstd":
+			zstdLevel := zstd.SpeedDefault
+			if level > 0 {
+				zstdLevel = zstd.EncoderLevelFromZstd(level)
+			}
+			newWriter = func() interface{} {
+				w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstdLevel), zstd.WithEncoderConcurrency(1))
+				return w
+			}
+		default:
+			continue
+		}
+		settings.pools[encoding] = &sync.Pool{New: newWriter}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settings = settings
+}
+
+// resettableWriter is implemented by the gzip, zlib and zstd writers
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (c *Compression) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.mu.RLock()
+		settings := c.settings
+		c.mu.RUnlock()
+		if !settings.enabled {
+			ctx.Next()
+			return
+		}
+		body, ok := settings.decompressRequest(ctx)
+		if !ok {
+			return
+		}
+		if body != nil {
+			defer body.Close()
+		}
+
+		encoding := negotiateEncoding(ctx.GetHeader("Accept-Encoding"), settings.encodings)
+		ctx.Writer.Header().Add("Vary", "Accept-Encoding")
+		if encoding == "" {
+			ctx.Next()
+			return
+		}
+		w := &compressWriter{ResponseWriter: ctx.Writer, encoding: encoding, minSize: settings.minSize, pool: settings.pools[encoding]}
+		ctx.Writer = w
+		defer w.finish()
+		ctx.Next()
+	}
+}
+
+// decompressRequest replaces a compressed body with its decompressed stream, so that the
+// handler's body size limit applies to the decompressed size, and returns the stream for the
+// caller to close once the handler has returned. ok is false if it answered the request.
+func (s *compressionSettings) decompressRequest(ctx *gin.Context) (body io.ReadCloser, ok bool) {
+	encoding := strings.ToLower(strings.TrimSpace(ctx.GetHeader("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil, true
+	}
+	if s.pools[encoding] == nil {
+		ctx.Abort()
+		resp.Return(ctx, http.StatusUnsupportedMediaType, "", nil, resp.NewError(resp.InvalidRequestCode,
+			"unsupported Content-Encoding: "+encoding, nil))
+		return nil, false
+	}
+	var err error
+	switch encoding {
+	case "gzip":
+		body, err = gzip.NewReader(ctx.Request.Body)
+	case "deflate":
+		body, err = zlib.NewReader(ctx.Request.Body)
+	case "zstd":
+		var decoder *zstd.Decoder
+		// The window bounds the memory a crafted frame can make the decoder allocate
+		decoder, err = zstd.NewReader(ctx.Request.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+		if err == nil {
+			body = decoder.IOReadCloser()
+		}
+	}
+	if err != nil {
+		ctx.Abort()
+		resp.ErrorReturn(ctx, "", resp.NewError(resp.ParseErrorCode, "invalid "+encoding+" request body: "+err.Error(), nil))
+		return nil, false
+	}
+	ctx.Request.Body = body
+	ctx.Request.ContentLength = -1
+	ctx.Request.Header.Del("Content-Encoding")
+	ctx.Request.Header.Del("Content-Length")
+	return body, true
+}
+
+// negotiateEncoding picks the first of encodings (the server's preference) that accept allows
+func negotiateEncoding(accept string, encodings []string) string {
+	if accept == "" {
+		return ""
+	}
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil {
+				weight = v
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+	for _, encoding := range encodings {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+		if ok && weight > 0 {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressWriter holds the body back until it reaches minSize, then streams it through
+// the compressor. Smaller bodies are sent unchanged by finish.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding   string
+	minSize    int
+	pool       *sync.Pool
+	buf        []byte
+	compressor resettableWriter
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.compressor != nil {
+		return w.compressor.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.minSize || !w.compressible() {
+		return len(data), nil
+	}
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.compressor = w.pool.Get().(resettableWriter)
+	w.compressor.Reset(w.ResponseWriter)
+	buffered := w.buf
+	w.buf = nil
+	if _, err := w.compressor.Write(buffered); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Written() bool {
+	return w.compressor != nil || len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// compressible reports whether the response may get a Content-Encoding
+func (w *compressWriter) compressible() bool {
+	status := w.ResponseWriter.Status()
+	return w.ResponseWriter.Header().Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK
+}
+
+// finish flushes the compressor, or writes a body that stayed below minSize as is
+func (w *compressWriter) finish() {
+	if w.compressor != nil {
+		_ = w.compressor.Close()
+		w.compressor.Reset(io.Discard)
+		w.pool.Put(w.compressor)
+		w.compressor = nil
+		return
+	}
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "zstd":
+		w, _ = zstd.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(bytes.NewReader(data))
+		if err == nil {
+			defer d.Close()
+			r = d
+		}
+	default:
+		return data
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// serveEcho posts body through the middleware to a route answering with the request body
+func serveEcho(c *Compression, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(c.Handler())
+	router.POST("/api/rpc", func(ctx *gin.Context) {
+		data, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.Data(http.StatusOK, "application/json", data)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/rpc", bytes.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	server := []string{"zstd", "gzip", "deflate"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"GZIP", "gzip"},
+		{"zstd;q=0, gzip;q=0.5", "gzip"},
+		{"deflate;q=1.0", "deflate"},
+		{"*", "zstd"},
+		{"*, zstd;q=0", "gzip"},
+		{"br", ""},
+		{"identity", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiateEncoding(tt.accept, server); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressResponse(t *testing.T) {
+	large := []byte(`{"data":"` + strings.Repeat("feitian ", 200) + `"}`)
+	small := []byte(`{"ok":true}`)
+	tests := []struct {
+		name         string
+		level        int
+		accept       string
+		body         []byte
+		wantEncoding string
+	}{
+		{"gzip", -1, "gzip", large, "gzip"},
+		{"deflate", 9, "deflate", large, "deflate"},
+		{"zstd default level", -1, "zstd", large, "zstd"},
+		{"zstd explicit level", 19, "zstd", large, "zstd"},
+		{"below the minimum size", -1, "gzip", small, ""},
+		{"nothing acceptable", -1, "br", large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCompression(config.CompressionConfiguration{
+				Enabled: true, MinSize: 256, Level: tt.level, Encodings: []string{"zstd", "gzip", "deflate"},
+			})
+			w := serveEcho(c, tt.body, map[string]string{"Accept-Encoding": tt.accept})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d (%s)", w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if got := decompress(t, tt.wantEncoding, w.Body.Bytes()); !bytes.Equal(got, tt.body) {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestDecompressRequest(t *testing.T) {
+	body := []byte(`{"jsonrpc":"2.0","id":"1","method":"ping"}`)
+	tests := []struct {
+		name       string
+		encoding   string
+		data       []byte
+		wantStatus int
+		wantBody   []byte
+	}{
+		{"gzip", "gzip", compress(t, "gzip", body), http.StatusOK, body},
+		{"deflate", "deflate", compress(t, "deflate", body), http.StatusOK, body},
+		{"zstd", "zstd", compress(t, "zstd", body), http.StatusOK, body},
+		{"identity", "identity", body, http.StatusOK, body},
+		{"not enabled", "br", body, http.StatusUnsupportedMediaType, nil},
+		{"corrupt gzip", "gzip", body, http.StatusOK, nil},
+		{"corrupt zstd", "zstd", body, http.StatusBadRequest, nil},
+	}
+	c := NewCompression(config.CompressionConfiguration{Enabled: true, MinSize: 1 << 20, Level: -1, Encodings: []string{"zstd", "gzip", "deflate"}})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveEcho(c, tt.data, map[string]string{"Content-Encoding": tt.encoding})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != nil && !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+				t.Errorf("handler read %q, want %q", w.Body, tt.wantBody)
+			}
+			if tt.wantBody == nil && bytes.Equal(w.Body.Bytes(), body) {
+				t.Errorf("handler was reached with the undecoded body")
+			}
+		})
+	}
+}
+
+func TestCompressionDisabled(t *testing.T) {
+	c := NewCompression(config.CompressionConfiguration{Enabled: true, Level: -1, Encodings: []string{"gzip"}})
+	c.Update(config.CompressionConfiguration{Enabled: false})
+	body := []byte(strings.Repeat("x", 1024))
+	w := serveEcho(c, body, map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("Content-Encoding") != "" || !bytes.Equal(w.Body.Bytes(), body) {
+		t.Errorf("response was compressed after Update disabled compression")
+	}
+}
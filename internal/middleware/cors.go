@@ -1,23 +1,190 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/config"
 )
 
-func Cors() gin.HandlerFunc {
+// CorsPolicy answers cross-origin requests from browsers according to a config.CorsConfiguration.
+// The allowed origin is reflected back only when it matches; other origins get no CORS headers,
+// so browsers refuse to hand them the response. Update replaces the policy at runtime.
+type CorsPolicy struct {
+	mu    sync.RWMutex
+	rules *corsRules
+}
+
+type corsRules struct {
+	anyOrigin     bool
+	origins       map[string]bool
+	wildcards     []wildcardOrigin
+	patterns      []*regexp.Regexp
+	credentials   bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// wildcardOrigin matches "https://*.example.com": any subdomain, but not the domain itself
+type wildcardOrigin struct {
+	scheme string // "https://"
+	suffix string // ".example.com", with the port if any
+}
+
+func NewCorsPolicy(conf config.CorsConfiguration) (*CorsPolicy, error) {
+	p := &CorsPolicy{}
+	if err := p.Update(conf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update applies a reloaded configuration; on error the current policy is kept
+func (p *CorsPolicy) Update(conf config.CorsConfiguration) error {
+	rules, err := compileCors(conf)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+	return nil
+}
+
+func compileCors(conf config.CorsConfiguration) (*corsRules, error) {
+	rules := &corsRules{
+		origins:       make(map[string]bool),
+		credentials:   conf.AllowCredentials,
+		allowMethods:  strings.Join(conf.AllowMethods, ", "),
+		allowHeaders:  strings.Join(conf.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(conf.ExposeHeaders, ", "),
+	}
+	if conf.MaxAge > 0 {
+		rules.maxAge = strconv.Itoa(int(conf.MaxAge.Seconds()))
+	}
+	for _, origin := range conf.AllowOrigins {
+		switch {
+		case origin == "*":
+			if conf.AllowCredentials {
+				return nil, fmt.Errorf("cors: origin \"*\" cannot be combined with credentials")
+			}
+			rules.anyOrigin = true
+		case strings.HasPrefix(origin, "regex:"):
+			pattern, err := regexp.Compile("^(?:" + strings.TrimPrefix(origin, "regex:") + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cors: origin %q: %w", origin, err)
+			}
+			rules.patterns = append(rules.patterns, pattern)
+		case strings.Contains(origin, "://*."):
+			scheme, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			rules.wildcards = append(rules.wildcards, wildcardOrigin{scheme: scheme, suffix: suffix})
+		default:
+			rules.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+	return rules, nil
+}
+
+// Trusts reports whether origin is listed explicitly, i.e. matches an entry other than "*"
+func (p *CorsPolicy) Trusts(origin string) bool {
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+	return rules.listed(origin)
+}
+
+func (r *corsRules) allows(origin string) bool {
+	return r.anyOrigin || r.listed(origin)
+}
+
+func (r *corsRules) listed(origin string) bool {
+	lower := strings.ToLower(origin)
+	if r.origins[lower] {
+		return true
+	}
+	for _, w := range r.wildcards {
+		rest, ok := strings.CutPrefix(lower, w.scheme)
+		if ok && len(rest) > len(w.suffix) && strings.HasSuffix(rest, w.suffix) && isHostLabels(rest[:len(rest)-len(w.suffix)]) {
+			return true
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHostLabels reports whether s only holds DNS labels, so that a wildcard cannot swallow a port or path
+func isHostLabels(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler returns the middleware; preflight requests are answered without reaching the routes
+func (p *CorsPolicy) Handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		method := c.Request.Method
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Accept, Content-Type,AccessToken,X-CSRF-Token, Authorization, Token,X-Token,X-UserID-Id")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT,DELETE,OPTIONS,PATCH")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		if method == http.MethodOptions {
-			c.AbortWithStatus(http.StatusNoContent)
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		p.mu.RLock()
+		rules := p.rules
+		p.mu.RUnlock()
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		// The response depends on the origin, so caches must not share it between origins
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !rules.allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
 			return
 		}
-		c.Next()
+
+		if rules.anyOrigin && !rules.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if rules.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if rules.exposeHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", rules.exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+		if rules.allowMethods != "" {
+			c.Header("Access-Control-Allow-Methods", rules.allowMethods)
+		}
+		if rules.allowHeaders != "" {
+			c.Header("Access-Control-Allow-Headers", rules.allowHeaders)
+		}
+		if rules.maxAge != "" {
+			c.Header("Access-Control-Max-Age", rules.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
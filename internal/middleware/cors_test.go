@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func serveWith(handler gin.HandlerFunc, method string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(handler)
+	router.Handle(method, "/api/rpc", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	req := httptest.NewRequest(method, "/api/rpc", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCorsOrigins(t *testing.T) {
+	policy, err := NewCorsPolicy(config.CorsConfiguration{
+		AllowOrigins: []string{
+			"https://app.example.com/",
+			"https://*.example.org",
+			`regex:https://review-[0-9]+\.example\.net`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://evil.com:1.example.org", false},
+		{"https://review-12.example.net", true},
+		{"https://review-12.example.net.evil.com", false},
+		{"https://review-x.example.net", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			w := serveWith(policy.Handler(), http.MethodPost, map[string]string{"Origin": tt.origin})
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.want && got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if !tt.want && got != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q for a foreign origin", got)
+			}
+			if policy.Trusts(tt.origin) != tt.want {
+				t.Errorf("Trusts = %v, want %v", !tt.want, tt.want)
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, the request must still reach the route", w.Code)
+			}
+		})
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	conf := config.CorsConfiguration{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowMethods:     []string{"GET", "POST"},
+		AllowHeaders:     []string{"Content-Type", "X-Api-Key"},
+		ExposeHeaders:    []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	policy, err := NewCorsPolicy(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		wantStatus  int
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "allowed preflight",
+			method:     http.MethodOptions,
+			headers:    map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Api-Key",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Expose-Headers":    "",
+			},
+		},
+		{
+			name:       "foreign preflight",
+			method:     http.MethodOptions,
+			headers:    map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": "POST"},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "",
+				"Access-Control-Allow-Methods": "",
+			},
+		},
+		{
+			name:       "simple request",
+			method:     http.MethodPost,
+			headers:    map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "Retry-After",
+				"Access-Control-Allow-Methods":  "",
+			},
+		},
+		{
+			name:       "same-origin request",
+			method:     http.MethodPost,
+			wantStatus: http.StatusOK,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(policy.Handler(), tt.method, tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if tt.headers["Origin"] != "" && w.Header().Values("Vary")[0] != "Origin" {
+				t.Errorf("Vary = %q, want Origin first", w.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCorsAnyOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials bool
+		wantErr     bool
+	}{
+		{"without credentials", false, false},
+		{"with credentials", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewCorsPolicy(config.CorsConfiguration{AllowOrigins: []string{"*"}, AllowCredentials: tt.credentials})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCorsPolicy error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			w := serveWith(policy.Handler(), http.MethodPost, map[string]string{"Origin": "https://any.example"})
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+			}
+			if policy.Trusts("https://any.example") {
+				t.Error("\"*\" must not make every origin trusted")
+			}
+		})
+	}
+}
+
+func TestCorsUpdate(t *testing.T) {
+	policy, err := NewCorsPolicy(config.CorsConfiguration{AllowOrigins: []string{"https://old.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Update(config.CorsConfiguration{AllowOrigins: []string{"regex:("}}); err == nil {
+		t.Fatal("Update accepted an invalid pattern")
+	}
+	if !policy.Trusts("https://old.example.com") {
+		t.Error("a failed Update replaced the policy")
+	}
+	if err := policy.Update(config.CorsConfiguration{AllowOrigins: []string{"https://new.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Trusts("https://old.example.com") || !policy.Trusts("https://new.example.com") {
+		t.Error("Update did not replace the origins")
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func TestCsrfGuard(t *testing.T) {
+	cors, err := NewCorsPolicy(config.CorsConfiguration{AllowOrigins: []string{"https://app.example.com", "*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const cookie = "session=s1; csrf_token=t1"
+	tests := []struct {
+		name       string
+		mode       string
+		method     string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"off", "off", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "https://evil.com"}, http.StatusOK},
+		{"safe method", "both", http.MethodGet, map[string]string{"Cookie": cookie, "Origin": "https://evil.com"}, http.StatusOK},
+		{"no cookies", "both", http.MethodPost, map[string]string{"Origin": "https://evil.com"}, http.StatusOK},
+
+		{"origin: same host", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "http://example.com"}, http.StatusOK},
+		{"origin: listed by CORS", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "https://app.example.com"}, http.StatusOK},
+		{"origin: only allowed by *", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "https://evil.com"}, http.StatusForbidden},
+		{"origin: from Referer", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Referer": "http://example.com/page"}, http.StatusOK},
+		{"origin: foreign Referer", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Referer": "https://evil.com/page"}, http.StatusForbidden},
+		{"origin: missing", "origin", http.MethodPost, map[string]string{"Cookie": cookie}, http.StatusForbidden},
+		{"origin: null", "origin", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "null"}, http.StatusForbidden},
+
+		{"token: matching header", "token", http.MethodPost, map[string]string{"Cookie": cookie, "X-CSRF-Token": "t1"}, http.StatusOK},
+		{"token: wrong header", "token", http.MethodPost, map[string]string{"Cookie": cookie, "X-CSRF-Token": "t2"}, http.StatusForbidden},
+		{"token: missing header", "token", http.MethodPost, map[string]string{"Cookie": cookie}, http.StatusForbidden},
+		{"token: missing cookie", "token", http.MethodPost, map[string]string{"Cookie": "session=s1", "X-CSRF-Token": ""}, http.StatusForbidden},
+
+		{"both: origin and token", "both", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "http://example.com", "X-CSRF-Token": "t1"}, http.StatusOK},
+		{"both: token without origin", "both", http.MethodPost, map[string]string{"Cookie": cookie, "X-CSRF-Token": "t1"}, http.StatusForbidden},
+		{"both: origin without token", "both", http.MethodPost, map[string]string{"Cookie": cookie, "Origin": "http://example.com"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.CsrfConfiguration{Mode: tt.mode, CookieName: "csrf_token", HeaderName: "X-CSRF-Token"}
+			w := serveWith(NewCsrfGuard(conf, cors).Handler(), tt.method, tt.headers)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(w.Body.String(), "csrf: ") {
+				t.Errorf("body = %s, want a csrf error", w.Body)
+			}
+		})
+	}
+}
+
+func TestCsrfCookie(t *testing.T) {
+	conf := config.CsrfConfiguration{Mode: "token", CookieName: "csrf_token", HeaderName: "X-CSRF-Token"}
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantIssued bool
+		wantSecure bool
+	}{
+		{"issued to a new client", nil, true, false},
+		{"secure over https", map[string]string{"X-Forwarded-Proto": "https"}, true, true},
+		{"kept when present", map[string]string{"Cookie": "csrf_token=t1"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(NewCsrfGuard(conf, nil).Handler(), http.MethodGet, tt.headers)
+			var issued *http.Cookie
+			for _, c := range w.Result().Cookies() {
+				if c.Name == "csrf_token" {
+					issued = c
+				}
+			}
+			if (issued != nil) != tt.wantIssued {
+				t.Fatalf("cookie issued = %v, want %v", issued != nil, tt.wantIssued)
+			}
+			if issued == nil {
+				return
+			}
+			if len(issued.Value) < 32 || issued.HttpOnly || issued.Secure != tt.wantSecure || issued.SameSite != http.SameSiteLaxMode {
+				t.Errorf("cookie = %+v, want a random, script-readable, SameSite=Lax token (Secure %v)", issued, tt.wantSecure)
+			}
+		})
+	}
+}
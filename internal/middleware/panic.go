@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PanicEvent describes a recovered panic. Method and RequestId are set for panics of an RPC call.
+type PanicEvent struct {
+	Time      time.Time `json:"time"`
+	Value     string    `json:"value"`
+	Stack     string    `json:"stack"`
+	Path      string    `json:"path,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	RequestId string    `json:"request_id,omitempty"`
+}
+
+// NewPanicEvent builds the event of the panic value recovered with stack (from debug.Stack)
+func NewPanicEvent(value interface{}, stack []byte) PanicEvent {
+	return PanicEvent{Time: time.Now(), Value: fmt.Sprint(value), Stack: string(stack)}
+}
+
+// PanicReporter receives recovered panics, e.g. to forward them to an error tracker such as Sentry.
+// ReportPanic is called on the goroutine that panicked and should not block for long.
+type PanicReporter interface {
+	ReportPanic(ctx context.Context, event PanicEvent)
+}
+
+// WriterPanicReporter writes each event as a line of JSON
+type WriterPanicReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPanicReporter(w io.Writer) *WriterPanicReporter {
+	return &WriterPanicReporter{w: w}
+}
+
+// NewFilePanicReporter appends events to the file at path, creating its directory; empty path means stdout
+func NewFilePanicReporter(path string) (*WriterPanicReporter, error) {
+	if path == "" {
+		return NewWriterPanicReporter(os.Stdout), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return NewWriterPanicReporter(f), nil
+}
+
+func (r *WriterPanicReporter) ReportPanic(_ context.Context, event PanicEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.w.Write(append(line, '\n'))
+}
@@ -1,23 +1,33 @@
 package middleware
 
 import (
-	"errors"
-	"runtime"
+	"net/http"
 	"runtime/debug"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 	"github.com/google/feitian/pkg/common/resp"
+	"github.com/rs/zerolog/log"
 )
 
-func HttpRecover() gin.HandlerFunc {
+// HttpRecover turns a panic outside of an RPC call into a 500 Internal error response and reports it.
+// Panics of RPC calls are recovered per call by the RPC handler, so that the rest of a batch still runs.
+func HttpRecover(reporter PanicReporter) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				stackTrace := debug.Stack()
-				runtime.Stack(stackTrace, true)
-				log.Error().Msgf("HttpRecover url: %s stackTrace %s", ctx.Request.URL.Path, string(stackTrace))
-				resp.ErrorReturn(ctx, "recover", errors.New("Internal Server Error"))
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				event := NewPanicEvent(r, debug.Stack())
+				event.Path = ctx.Request.URL.Path
+				log.Error().Str("path", event.Path).Str("panic", event.Value).Str("stack", event.Stack).Msg("Recovered from panic")
+				if reporter != nil {
+					reporter.ReportPanic(ctx.Request.Context(), event)
+				}
+				ctx.Abort()
+				if !ctx.Writer.Written() {
+					resp.Return(ctx, http.StatusInternalServerError, "", nil, resp.NewError(resp.InternalErrorCode, "internal error", nil))
+				}
 			}
 		}()
 		ctx.Next()
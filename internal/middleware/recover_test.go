@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// recordingReporter keeps the events it receives
+type recordingReporter struct {
+	mu     sync.Mutex
+	events []PanicEvent
+}
+
+func (r *recordingReporter) ReportPanic(_ context.Context, event PanicEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func servePanic(reporter PanicReporter, value interface{}) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(HttpRecover(reporter))
+	router.GET("/health", func(c *gin.Context) { panic(value) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	return w
+}
+
+func TestHttpRecover(t *testing.T) {
+	reporter := &recordingReporter{}
+	w := servePanic(reporter, "boom")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	var response resp.RpcResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error == nil || response.Error.Code != resp.InternalErrorCode {
+		t.Errorf("body = %s, want an internal error", w.Body)
+	}
+	if len(reporter.events) != 1 {
+		t.Fatalf("reported %d events, want 1", len(reporter.events))
+	}
+	if event := reporter.events[0]; event.Value != "boom" || event.Path != "/health" || event.Stack == "" {
+		t.Errorf("event = %+v", event)
+	}
+
+	// Without a reporter the panic is still recovered
+	if w := servePanic(nil, "boom"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status without a reporter = %d, want 500", w.Code)
+	}
+}
+
+func TestHttpRecoverRepanicsAbort(t *testing.T) {
+	reporter := &recordingReporter{}
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on to net/http", r)
+		}
+		if len(reporter.events) != 0 {
+			t.Errorf("reported %+v, want aborts left unreported", reporter.events)
+		}
+	}()
+	servePanic(reporter, http.ErrAbortHandler)
+}
+
+func TestWriterPanicReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewWriterPanicReporter(&buf)
+	r.ReportPanic(context.Background(), PanicEvent{Value: "boom", Method: "echo"})
+	r.ReportPanic(context.Background(), PanicEvent{Value: "again"})
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("wrote %q, want one line per event", buf.String())
+	}
+	var event PanicEvent
+	if err := json.Unmarshal(lines[0], &event); err != nil || event.Value != "boom" || event.Method != "echo" {
+		t.Errorf("first line = %s, %v", lines[0], err)
+	}
+}
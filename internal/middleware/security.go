@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/feitian/pkg/common/config"
+)
+
+// SecurityHeaders adds the response headers of a config.SecurityConfiguration.
+// Handlers may override them, e.g. a page needing a looser Content-Security-Policy.
+type SecurityHeaders struct {
+	mu   sync.RWMutex
+	conf config.SecurityConfiguration
+}
+
+func NewSecurityHeaders(conf config.SecurityConfiguration) *SecurityHeaders {
+	return &SecurityHeaders{conf: conf}
+}
+
+// Update applies a reloaded configuration
+func (s *SecurityHeaders) Update(conf config.SecurityConfiguration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf = conf
+}
+
+func (s *SecurityHeaders) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.mu.RLock()
+		conf := s.conf
+		s.mu.RUnlock()
+
+		// Browsers ignore HSTS received over plain HTTP, and it must not pin a host only reachable that way
+		if conf.HSTSMaxAge > 0 && isHTTPS(c) {
+			value := "max-age=" + strconv.Itoa(int(conf.HSTSMaxAge.Seconds()))
+			if conf.HSTSIncludeSubdomains {
+				value += "; includeSubDomains"
+			}
+			c.Header("Strict-Transport-Security", value)
+		}
+		if conf.NoSniff {
+			c.Header("X-Content-Type-Options", "nosniff")
+		}
+		if conf.FrameOptions != "" {
+			c.Header("X-Frame-Options", conf.FrameOptions)
+		}
+		if conf.ContentSecurityPolicy != "" {
+			c.Header("Content-Security-Policy", conf.ContentSecurityPolicy)
+		}
+		if conf.ReferrerPolicy != "" {
+			c.Header("Referrer-Policy", conf.ReferrerPolicy)
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS reports whether the client used HTTPS, directly or through a TLS-terminating proxy
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	full := config.SecurityConfiguration{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		NoSniff:               true,
+		FrameOptions:          "DENY",
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}
+	tests := []struct {
+		name    string
+		conf    config.SecurityConfiguration
+		headers map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "https through a proxy",
+			conf:    full,
+			headers: map[string]string{"X-Forwarded-Proto": "HTTPS"},
+			want: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Content-Security-Policy":   "default-src 'none'",
+				"Referrer-Policy":           "no-referrer",
+			},
+		},
+		{
+			name: "no HSTS over plain http",
+			conf: full,
+			want: map[string]string{
+				"Strict-Transport-Security": "",
+				"X-Frame-Options":           "DENY",
+			},
+		},
+		{
+			name:    "HSTS without subdomains",
+			conf:    config.SecurityConfiguration{HSTSMaxAge: time.Hour},
+			headers: map[string]string{"X-Forwarded-Proto": "https"},
+			want:    map[string]string{"Strict-Transport-Security": "max-age=3600"},
+		},
+		{
+			name:    "everything disabled",
+			headers: map[string]string{"X-Forwarded-Proto": "https"},
+			want: map[string]string{
+				"Strict-Transport-Security": "",
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Content-Security-Policy":   "",
+				"Referrer-Policy":           "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveWith(NewSecurityHeaders(tt.conf).Handler(), http.MethodGet, tt.headers)
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersUpdate(t *testing.T) {
+	headers := NewSecurityHeaders(config.SecurityConfiguration{FrameOptions: "DENY"})
+	headers.Update(config.SecurityConfiguration{FrameOptions: "SAMEORIGIN"})
+	w := serveWith(headers.Handler(), http.MethodGet, nil)
+	if got := w.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options = %q after Update, want SAMEORIGIN", got)
+	}
+}
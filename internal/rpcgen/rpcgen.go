@@ -0,0 +1,72 @@
+package rpcgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/google/feitian/pkg/openrpc"
+)
+
+// Load reads an OpenRPC document from an http(s) URL or a file path
+func Load(source string) (*openrpc.Document, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		res, err := http.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch %s: http status %d", source, res.StatusCode)
+		}
+		if data, err = io.ReadAll(res.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+	var doc openrpc.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode openrpc document: %w", err)
+	}
+	if doc.Components == nil {
+		doc.Components = &openrpc.Components{}
+	}
+	return &doc, nil
+}
+
+// exportedName converts a method or property name ("user.get", "retry_after") into an exported identifier
+func exportedName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	out := b.String()
+	if out == "" || unicode.IsDigit(rune(out[0])) {
+		out = "X" + out
+	}
+	return out
+}
+
+// hasParams reports whether the generated stub takes a params argument
+func hasParams(m *openrpc.Method) bool {
+	return m.XParamsSchema != nil || len(m.Params) > 0
+}
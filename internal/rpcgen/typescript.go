@@ -0,0 +1,291 @@
+package rpcgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/feitian/pkg/openrpc"
+)
+
+// TypeScript emits a self-contained TypeScript module: interfaces for component
+// schemas and method params, a Methods map from method name to params/result,
+// and a fetch-based client with one typed function per method plus batching
+func TypeScript(doc *openrpc.Document) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by rpcgen from %s %s. DO NOT EDIT.\n\n", doc.Info.Title, doc.Info.Version)
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := doc.Components.Schemas[name]
+		if schema.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", schema.Description)
+		}
+		if schema.Type == "object" && schema.AdditionalProperties == nil && len(schema.Properties) > 0 {
+			fmt.Fprintf(&b, "export interface %s %s\n\n", exportedName(name), tsObject(schema, ""))
+		} else {
+			fmt.Fprintf(&b, "export type %s = %s;\n\n", exportedName(name), tsType(schema, ""))
+		}
+	}
+
+	for i := range doc.Methods {
+		m := &doc.Methods[i]
+		if !hasParams(m) {
+			continue
+		}
+		params := m.ParamsSchema()
+		if m.XParamsSchema == nil {
+			fmt.Fprintf(&b, "export interface %sParams %s\n\n", exportedName(m.Name), tsObject(params, ""))
+		} else {
+			fmt.Fprintf(&b, "export type %sParams = %s;\n\n", exportedName(m.Name), tsType(params, ""))
+		}
+	}
+
+	b.WriteString("/** Params and result type of every method, keyed by method name */\n")
+	b.WriteString("export interface Methods {\n")
+	for i := range doc.Methods {
+		m := &doc.Methods[i]
+		params := "undefined"
+		if hasParams(m) {
+			params = exportedName(m.Name) + "Params"
+		}
+		fmt.Fprintf(&b, "  %q: { params: %s; result: %s };\n", m.Name, params, tsType(m.Result.Schema, "  "))
+	}
+	b.WriteString("}\n")
+	b.WriteString(tsRuntime)
+
+	b.WriteString("\n/** Typed client: one function per method */\n")
+	b.WriteString("export class ApiClient extends RpcClient {\n")
+	for i := range doc.Methods {
+		m := &doc.Methods[i]
+		name := exportedName(m.Name)
+		fn := strings.ToLower(name[:1]) + name[1:]
+		var doc []string
+		if m.Summary != "" {
+			doc = append(doc, m.Summary)
+		}
+		if m.XAuthRequired {
+			doc = append(doc, "Requires authentication.")
+		}
+		if len(doc) > 0 {
+			fmt.Fprintf(&b, "  /** %s */\n", strings.Join(doc, " "))
+		}
+		if hasParams(m) {
+			fmt.Fprintf(&b, "  %s(params: %sParams): Promise<Methods[%q][\"result\"]> {\n", fn, name, m.Name)
+			fmt.Fprintf(&b, "    return this.call(%q, params);\n  }\n\n", m.Name)
+		} else {
+			fmt.Fprintf(&b, "  %s(): Promise<Methods[%q][\"result\"]> {\n", fn, m.Name)
+			fmt.Fprintf(&b, "    return this.call(%q, undefined);\n  }\n\n", m.Name)
+		}
+	}
+	out := bytes.TrimRight(b.Bytes(), "\n")
+	return append(out, []byte("\n}\n")...), nil
+}
+
+func tsType(s *openrpc.Schema, indent string) string {
+	if s == nil {
+		return "unknown"
+	}
+	if s.Ref != "" {
+		return exportedName(openrpc.RefName(s.Ref))
+	}
+	var t string
+	switch s.Type {
+	case "boolean":
+		t = "boolean"
+	case "integer", "number":
+		t = "number"
+	case "string":
+		t = "string"
+	case "array":
+		item := tsType(s.Items, indent)
+		if strings.ContainsAny(item, " |") {
+			item = "(" + item + ")"
+		}
+		t = item + "[]"
+	case "object":
+		if s.AdditionalProperties != nil || len(s.Properties) == 0 {
+			t = "Record<string, " + tsType(s.AdditionalProperties, indent) + ">"
+		} else {
+			t = tsObject(s, indent)
+		}
+	default:
+		return "unknown"
+	}
+	if s.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+func tsObject(s *openrpc.Schema, indent string) string {
+	required := make(map[string]bool, len(s.Required))
+	for _, name := range s.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, name := range names {
+		prop := s.Properties[name]
+		if prop.Description != "" {
+			fmt.Fprintf(&b, "%s  /** %s */\n", indent, prop.Description)
+		}
+		optional := ""
+		if !required[name] {
+			optional = "?"
+		}
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, tsKey(name), optional, tsType(prop, indent+"  "))
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// tsKey quotes property names that are not valid identifiers
+func tsKey(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return strconv.Quote(name)
+		}
+	}
+	if name == "" {
+		return `""`
+	}
+	return name
+}
+
+// tsRuntime is the untyped part of the generated client
+const tsRuntime = `
+/** Error returned by the server; code follows JSON-RPC 2.0 (see pkg/common/resp) */
+export class RpcError extends Error {
+  constructor(public code: number, message: string, public data?: unknown) {
+    super(message);
+    this.name = "RpcError";
+  }
+}
+
+export interface ClientOptions {
+  /** Endpoint, e.g. "/api/rpc" */
+  url: string;
+  /** Extra headers sent with every request, e.g. Authorization */
+  headers?: Record<string, string>;
+  /** Custom fetch implementation (defaults to the global fetch) */
+  fetch?: typeof fetch;
+}
+
+interface RpcResponse {
+  jsonrpc: "2.0";
+  id: string;
+  result?: unknown;
+  error?: { code: number; message: string; data?: unknown };
+}
+
+export class RpcClient {
+  private nextId = 1;
+
+  constructor(private options: ClientOptions) {}
+
+  call<M extends keyof Methods>(method: M, params: Methods[M]["params"]): Promise<Methods[M]["result"]> {
+    const request = { jsonrpc: "2.0", method, params, id: String(this.nextId++) };
+    return this.post(request).then((response) => settle(response as RpcResponse)) as Promise<Methods[M]["result"]>;
+  }
+
+  notify<M extends keyof Methods>(method: M, params: Methods[M]["params"]): Promise<void> {
+    return this.post({ jsonrpc: "2.0", method, params }).then(() => undefined);
+  }
+
+  batch(): Batch {
+    return new Batch(this, () => String(this.nextId++));
+  }
+
+  /** @internal */
+  async post(body: unknown): Promise<unknown> {
+    const doFetch = this.options.fetch ?? fetch;
+    const res = await doFetch(this.options.url, {
+      method: "POST",
+      headers: { "Content-Type": "application/json", ...this.options.headers },
+      body: JSON.stringify(body),
+    });
+    if (res.status === 204) {
+      return undefined;
+    }
+    const text = await res.text();
+    let payload: unknown;
+    try {
+      payload = JSON.parse(text);
+    } catch {
+      throw new RpcError(res.status, "HTTP " + res.status + ": " + text);
+    }
+    if (!res.ok && !Array.isArray(payload) && !(payload as RpcResponse).error) {
+      throw new RpcError(res.status, "HTTP " + res.status + ": " + text);
+    }
+    return payload;
+  }
+}
+
+/** Batch collects calls and sends them in a single request */
+export class Batch {
+  private requests: object[] = [];
+  private pending = new Map<string, { resolve: (v: unknown) => void; reject: (e: unknown) => void }>();
+
+  constructor(private client: RpcClient, private newId: () => string) {}
+
+  call<M extends keyof Methods>(method: M, params: Methods[M]["params"]): Promise<Methods[M]["result"]> {
+    const id = this.newId();
+    this.requests.push({ jsonrpc: "2.0", method, params, id });
+    return new Promise((resolve, reject) => {
+      this.pending.set(id, { resolve: resolve as (v: unknown) => void, reject });
+    });
+  }
+
+  notify<M extends keyof Methods>(method: M, params: Methods[M]["params"]): void {
+    this.requests.push({ jsonrpc: "2.0", method, params });
+  }
+
+  /** Sends the batch; the promises returned by call settle with their own result or error */
+  async send(): Promise<void> {
+    let payload: unknown;
+    try {
+      payload = await this.client.post(this.requests);
+    } catch (e) {
+      this.pending.forEach((p) => p.reject(e));
+      throw e;
+    }
+    const responses: RpcResponse[] = Array.isArray(payload) ? payload : payload ? [payload as RpcResponse] : [];
+    for (const response of responses) {
+      const p = this.pending.get(response.id);
+      if (!p) {
+        continue;
+      }
+      this.pending.delete(response.id);
+      try {
+        p.resolve(settle(response));
+      } catch (e) {
+        p.reject(e);
+      }
+    }
+    const whole = responses.length === 1 && !responses[0].id ? responses[0].error : undefined;
+    this.pending.forEach((p) => p.reject(whole ? new RpcError(whole.code, whole.message, whole.data) : new Error("no response for batched call")));
+    this.pending.clear();
+  }
+}
+
+function settle(response: RpcResponse): unknown {
+  if (response.error) {
+    throw new RpcError(response.error.code, response.error.message, response.error.data);
+  }
+  return response.result;
+}
+`
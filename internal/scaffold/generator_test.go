@@ -0,0 +1,48 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	if err := Generate(dir, Data{Module: "example.com/app", AppName: "demo"}); err != nil {
+		t.Fatal(err)
+	}
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		check func(content string) bool
+	}{
+		{"module path", "go.mod", func(c string) bool { return strings.HasPrefix(c, "module example.com/app\n") }},
+		{"app name", "configs/config.toml", func(c string) bool { return strings.Contains(c, `DBName = "demo"`) }},
+		{"redaction copied verbatim", "pkg/common/config/redact.go", func(c string) bool { return c == config.RedactSource }},
+		{"config dump redacted", "cmd/main.go", func(c string) bool {
+			return strings.Contains(c, "config.Dump(appConfig)") && !strings.Contains(c, "MarshalIndent")
+		}},
+		{"passwords tagged secret", "pkg/common/config/config.go", func(c string) bool {
+			return strings.Count(c, `mapstructure:"Password" secret:"true"`) == 2
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.check(read(tt.path)) {
+				t.Errorf("%s:\n%s", tt.path, read(tt.path))
+			}
+		})
+	}
+}
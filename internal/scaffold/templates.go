@@ -1,5 +1,7 @@
 package scaffold
 
+import "github.com/google/feitian/pkg/common/config"
+
 var templates = map[string]string{
 	"go.mod": `module {{.Module}}
 
@@ -36,13 +38,36 @@ TimeZone = "Asia/Shanghai"
 Addr = "127.0.0.1:6379"
 Db = 0
 Password = ""
+`,
+	"configs/config.dev.toml": `# Merged over config.toml with -profile dev or APP_PROFILE=dev
+
+[ServiceConfiguration]
+Debug = true
+`,
+	"configs/config.staging.toml": `# Merged over config.toml with -profile staging or APP_PROFILE=staging
+
+[ServiceConfiguration]
+Debug = false
+
+[PostgresConfiguration]
+Host = "postgres.staging.internal"
+`,
+	"configs/config.prod.toml": `# Merged over config.toml with -profile prod or APP_PROFILE=prod
+# Set passwords through APP_POSTGRESCONFIGURATION_PASSWORD and APP_REDISCONFIGURATION_PASSWORD
+
+[ServiceConfiguration]
+Debug = false
+
+[PostgresConfiguration]
+Host = "postgres.prod.internal"
+SSLMode = true
 `,
 	"cmd/main.go": `package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -56,6 +81,7 @@ import (
 
 var configFilename string
 var configDirs string
+var profile string
 
 func init() {
 	const (
@@ -65,18 +91,22 @@ func init() {
 	flag.StringVar(&configFilename, "c", defaultConfigFilename, "Name of the config file, without extension")
 	flag.StringVar(&configFilename, "dev_config", defaultConfigFilename, "Name of the config file, without extension")
 	flag.StringVar(&configDirs, "cPath", defaultConfigDirs, "Directories to search for config file, separated by ','")
+	flag.StringVar(&profile, "profile", os.Getenv(config.EnvPrefix+"_PROFILE"), "Config profile merged over the base file: dev, staging or prod")
 }
 
 func main() {
 	flag.Parse()
 
 	var appConfig conf.Config
-	if err := config.InitConfiguration(configFilename, strings.Split(configDirs, ","), &appConfig); err != nil {
+	if err := config.InitConfiguration(configFilename, profile, strings.Split(configDirs, ","), &appConfig); err != nil {
 		panic(err)
 	}
-	if b, err := json.MarshalIndent(appConfig, "", "  "); err == nil {
-		fmt.Println(string(b))
+	// Secret fields are printed as ******
+	dump, err := config.Dump(appConfig)
+	if err != nil {
+		panic(err)
 	}
+	fmt.Println(string(dump))
 	fmt.Println("Config loaded successfully!")
 
 	// Logger
@@ -169,6 +199,7 @@ func (a *ApiServer) Run() error {
 		a.app = gin.New()
 		a.app.Use(middleware.HttpRecover())
 		a.app.Use(gin.Logger())
+		a.app.Use(middleware.SecurityHeaders())
 		a.app.Use(middleware.Cors())
 	}
 	a.Router()
@@ -261,6 +292,24 @@ func (m *EchoMethod) Execute(ctx context.Context, params json.RawMessage) (inter
 	return map[string]any{"echo": input, "time": time.Now().Unix()}, nil
 }
 func (m *EchoMethod) RequireAuth() bool { return false }
+`,
+	"internal/middleware/security.go": `package middleware
+
+import "github.com/gin-gonic/gin"
+
+// SecurityHeaders adds conservative browser security headers; handlers serving HTML may override the CSP
+func SecurityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			c.Header("Strict-Transport-Security", "max-age=31536000")
+		}
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-Frame-Options", "DENY")
+		c.Header("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Next()
+	}
+}
 `,
 	"internal/middleware/cors.go": `package middleware
 
@@ -277,7 +326,7 @@ func Cors() gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Accept, Content-Type,AccessToken,X-CSRF-Token, Authorization, Token,X-Token,X-UserID-Id")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT,DELETE,OPTIONS,PATCH")
 		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
+		// No Allow-Credentials: browsers reject it with a "*" origin. List the origins to send cookies.
 		if method == http.MethodOptions { c.AbortWithStatus(http.StatusNoContent); return }
 		c.Next()
 	}
@@ -286,8 +335,7 @@ func Cors() gin.HandlerFunc {
 	"internal/middleware/recover.go": `package middleware
 
 import (
-	"errors"
-	"runtime"
+	"net/http"
 	"runtime/debug"
 
 	"github.com/gin-gonic/gin"
@@ -299,9 +347,8 @@ func HttpRecover() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				stackTrace := debug.Stack(); runtime.Stack(stackTrace, true)
-				log.Error().Msgf("HttpRecover url: %s stackTrace %s", ctx.Request.URL.Path, string(stackTrace))
-				resp.ErrorReturn(ctx, "recover", errors.New("Internal Server Error"))
+				log.Error().Msgf("HttpRecover url: %s panic: %v stackTrace %s", ctx.Request.URL.Path, err, debug.Stack())
+				ctx.AbortWithStatusJSON(http.StatusInternalServerError, resp.RpcResponse{JsonRPC: "2.0", Error: &resp.RpcError{Code: -32603, Message: "internal error"}})
 			}
 		}()
 		ctx.Next()
@@ -323,27 +370,53 @@ func (s *Storage) GetDB() *gorm.DB { return s.db }
 	"pkg/common/config/config.go": `package config
 
 import (
+	"reflect"
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
-type PostgresConfiguration struct { Host string ` + "`mapstructure:\"Host\"`" + `; Port int ` + "`mapstructure:\"Port\"`" + `; User string ` + "`mapstructure:\"User\"`" + `; Password string ` + "`mapstructure:\"Password\"`" + `; DBName string ` + "`mapstructure:\"DBName\"`" + `; SSLMode bool ` + "`mapstructure:\"SSLMode\"`" + `; TimeZone string ` + "`mapstructure:\"TimeZone\"`" + ` }
+type PostgresConfiguration struct { Host string ` + "`mapstructure:\"Host\"`" + `; Port int ` + "`mapstructure:\"Port\"`" + `; User string ` + "`mapstructure:\"User\"`" + `; Password string ` + "`mapstructure:\"Password\" secret:\"true\"`" + `; DBName string ` + "`mapstructure:\"DBName\"`" + `; SSLMode bool ` + "`mapstructure:\"SSLMode\"`" + `; TimeZone string ` + "`mapstructure:\"TimeZone\"`" + ` }
 
 type ServiceConfiguration struct { Port string ` + "`mapstructure:\"Port\"`" + `; Debug bool ` + "`mapstructure:\"Debug\"`" + ` }
 
-type RedisConfiguration struct { Addr string ` + "`mapstructure:\"Addr\"`" + `; Db int ` + "`mapstructure:\"Db\"`" + `; Password string ` + "`mapstructure:\"Password\"`" + ` }
+type RedisConfiguration struct { Addr string ` + "`mapstructure:\"Addr\"`" + `; Db int ` + "`mapstructure:\"Db\"`" + `; Password string ` + "`mapstructure:\"Password\" secret:\"true\"`" + ` }
 
 type LoggerConfig struct { Filename string ` + "`mapstructure:\"Filename\"`" + `; MaxSize int ` + "`mapstructure:\"MaxSize\"`" + ` }
 
-func InitConfiguration(configName string, configPaths []string, config interface{}) error {
-	vp := viper.New(); vp.SetConfigName(configName); vp.AutomaticEnv();
+// Env vars override file values: APP_<SECTION>_<KEY>, e.g. APP_POSTGRESCONFIGURATION_PASSWORD
+const EnvPrefix = "APP"
+
+// Files are deep-merged in order: config.toml, config.<profile>.toml (if profile is set), config.local.toml
+func InitConfiguration(configName, profile string, configPaths []string, config interface{}) error {
+	vp := viper.New()
+	vp.SetEnvPrefix(EnvPrefix); vp.SetEnvKeyReplacer(strings.NewReplacer(".", "_")); vp.AutomaticEnv()
+	for _, key := range envKeys(reflect.TypeOf(config).Elem(), "") { if err := vp.BindEnv(key); err != nil { return errors.WithStack(err) } }
 	for _, p := range configPaths { vp.AddConfigPath(p) }
-	if err := vp.ReadInConfig(); err != nil { if _, ok := err.(viper.ConfigFileNotFoundError); !ok { return errors.WithStack(err) } }
+	layers := []string{configName}
+	if profile != "" { layers = append(layers, configName+"."+profile) }
+	for _, layer := range append(layers, configName+".local") {
+		vp.SetConfigName(layer)
+		if err := vp.MergeInConfig(); err != nil { if _, ok := err.(viper.ConfigFileNotFoundError); !ok { return errors.WithStack(err) } }
+	}
 	if err := vp.Unmarshal(config); err != nil { return errors.WithStack(err) }
-	for _, key := range vp.AllKeys() { if err := vp.BindEnv(key); err != nil { return errors.WithStack(err) } }
 	return nil
 }
+
+// envKeys lists the dotted mapstructure paths of the leaf fields, so env vars work for keys absent from the file
+func envKeys(t reflect.Type, parent string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i); name := f.Tag.Get("mapstructure"); if name == "" { name = f.Name }
+		if parent != "" { name = parent + "." + name }
+		if f.Type.Kind() == reflect.Struct { keys = append(keys, envKeys(f.Type, name)...) } else { keys = append(keys, name) }
+	}
+	return keys
+}
 `,
+	// Redaction is copied from this module rather than duplicated, so both stay the same
+	"pkg/common/config/redact.go": config.RedactSource,
 	"pkg/common/client/pgsql.go": `package client
 
 import (
@@ -422,7 +495,7 @@ func SimpleReturn(ctx *gin.Context, id string, data interface{}) { Return(ctx, 2
 func ErrorReturn(ctx *gin.Context, id string, err error) { Return(ctx, 200, id, nil, err) }
 func Return(ctx *gin.Context, code int, id string, data interface{}, err error) {
 	response := RpcResponse{ JsonRPC: "2.0", Id: id }
-	if err != nil { response.Error = &RpcError{ Code: -32000, Message: err.Error() } } else { jsonData, _ := json.Marshal(data); response.Result = jsonData }
+	if err != nil { response.Error = &RpcError{ Code: -32000, Message: err.Error() } } else if jsonData, mErr := json.Marshal(data); mErr != nil { response.Error = &RpcError{ Code: -32603, Message: "encode result: " + mErr.Error() } } else { response.Result = jsonData }
 	ctx.JSON(code, response)
 }
 `,
@@ -485,6 +558,9 @@ clean:
 /logs/*
 !/logs/.gitkeep
 
+# Developer config overrides
+config.local.toml
+
 # IDE
 .idea/
 .vscode/
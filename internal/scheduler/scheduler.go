@@ -0,0 +1,255 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/feitian/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	lockPrefix     = "scheduler:"
+	historyKey     = "scheduler:history"
+	lockTTL        = 30 * time.Second
+	defaultTimeout = time.Hour
+)
+
+// Task is a periodic job
+// Schedule: standard 5-field cron expression or descriptor ("@hourly", "@every 30s");
+// Jitter: random delay added to every run, capped at half the time between two slots;
+// Timeout: cancels the run's context (default 1h).
+
+type Task struct {
+	Name     string
+	Schedule string
+	Jitter   time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// TaskStatus is the last known run of a task, shared by all replicas
+
+type TaskStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Slot     time.Time `json:"slot"`
+	LastRun  time.Time `json:"last_run"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+	Node     string    `json:"node"`
+	NextRun  time.Time `json:"next_run"`
+}
+
+type registeredTask struct {
+	Task
+	schedule cron.Schedule
+}
+
+// Scheduler runs registered tasks on every replica, but a per-task lock plus the
+// recorded schedule slot make sure each slot is executed by exactly one replica
+// and that runs of the same task never overlap.
+
+type Scheduler struct {
+	locker storage.Locker
+	redis  *redis.Client
+	node   string
+	mu     sync.Mutex
+	tasks  map[string]*registeredTask
+	loops  sync.WaitGroup
+}
+
+func New(locker storage.Locker, redisConn *redis.Client) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		locker: locker,
+		redis:  redisConn,
+		node:   fmt.Sprintf("%s-%d", host, os.Getpid()),
+		tasks:  make(map[string]*registeredTask),
+	}
+}
+
+// Register adds a task; call it before Start
+func (s *Scheduler) Register(task Task) error {
+	if task.Name == "" || task.Run == nil {
+		return errors.New("scheduler: task needs a name and a Run func")
+	}
+	schedule, err := cron.ParseStandard(task.Schedule)
+	if err != nil {
+		return fmt.Errorf("scheduler: task %s: %w", task.Name, err)
+	}
+	if task.Timeout <= 0 {
+		task.Timeout = defaultTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.Name] = &registeredTask{Task: task, schedule: schedule}
+	return nil
+}
+
+// Start runs every registered task in its own goroutine until ctx is cancelled; cancelling ctx
+// also cancels the runs in progress. Wait blocks until they have returned.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range s.tasks {
+		s.loops.Add(1)
+		go func() {
+			defer s.loops.Done()
+			s.loop(ctx, task)
+		}()
+	}
+	log.Info().Int("tasks", len(s.tasks)).Msg("Scheduler started")
+}
+
+// Wait blocks until the goroutines started by Start have returned
+func (s *Scheduler) Wait() {
+	s.loops.Wait()
+}
+
+// History returns the last run of every registered task
+func (s *Scheduler) History(ctx context.Context) ([]TaskStatus, error) {
+	raw, err := s.redis.HGetAll(ctx, historyKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+	for name, task := range s.tasks {
+		status := TaskStatus{Name: name}
+		if data, ok := raw[name]; ok {
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				return nil, err
+			}
+		}
+		status.Schedule = task.Schedule
+		status.NextRun = nextSlot(task.schedule, time.Now())
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, task *registeredTask) {
+	for {
+		slot := nextSlot(task.schedule, time.Now())
+		wait := time.Until(slot)
+		// Jitter must not delay a run into the next slot
+		if jitter := min(task.Jitter, nextSlot(task.schedule, slot).Sub(slot)/2); jitter > 0 {
+			wait += rand.N(jitter)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runSlot(ctx, task, slot)
+	}
+}
+
+// nextSlot returns the first slot of schedule after now. Cron expressions name wall-clock times,
+// but "@every" counts from the time it is asked, so its slots are aligned to multiples of the
+// interval since the zero time instead; either way every replica computes the same slots.
+func nextSlot(schedule cron.Schedule, now time.Time) time.Time {
+	if every, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		return now.Truncate(every.Delay).Add(every.Delay)
+	}
+	return schedule.Next(now)
+}
+
+// runSlot runs the task for slot unless another replica holds it or already ran it
+func (s *Scheduler) runSlot(ctx context.Context, task *registeredTask, slot time.Time) {
+	logger := log.With().Str("task", task.Name).Logger()
+	lock, err := s.locker.TryLock(ctx, lockPrefix+task.Name, lockTTL)
+	if errors.Is(err, storage.ErrLockNotAcquired) {
+		logger.Debug().Msg("task is running elsewhere, skipping")
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to acquire task lock")
+		return
+	}
+	defer lock.Unlock(context.Background())
+
+	last, err := s.lastStatus(ctx, task.Name)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to read task history")
+		return
+	}
+	if !last.Slot.Before(slot) {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, task.Timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	start := time.Now()
+	err = runTask(runCtx, task.Run)
+	status := TaskStatus{
+		Name:     task.Name,
+		Slot:     slot,
+		LastRun:  start,
+		Duration: time.Since(start).String(),
+		Node:     s.node,
+	}
+	if err != nil {
+		status.Error = err.Error()
+		logger.Error().Err(err).Str("duration", status.Duration).Msg("task failed")
+	} else {
+		logger.Info().Str("duration", status.Duration).Msg("task finished")
+	}
+	if err := s.saveStatus(context.Background(), status); err != nil {
+		logger.Error().Err(err).Msg("failed to record task history")
+	}
+}
+
+func (s *Scheduler) lastStatus(ctx context.Context, name string) (TaskStatus, error) {
+	var status TaskStatus
+	raw, err := s.redis.HGet(ctx, historyKey, name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	err = json.Unmarshal(raw, &status)
+	return status, err
+}
+
+func (s *Scheduler) saveStatus(ctx context.Context, status TaskStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return s.redis.HSet(ctx, historyKey, status.Name, data).Err()
+}
+
+func runTask(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Msgf("task panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/feitian/internal/storage"
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+)
+
+func newTestScheduler(t *testing.T, mr *miniredis.Miniredis) *Scheduler {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(storage.NewRedisLocker(client), client)
+}
+
+func TestNextSlot(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		schedule string
+		now      string
+		want     string
+	}{
+		{"@every 30s", "2026-01-01T10:00:07Z", "2026-01-01T10:00:30Z"},
+		{"@every 30s", "2026-01-01T10:00:29.999Z", "2026-01-01T10:00:30Z"},
+		{"@every 30s", "2026-01-01T10:00:30Z", "2026-01-01T10:01:00Z"},
+		{"@every 1h", "2026-01-01T10:59:00Z", "2026-01-01T11:00:00Z"},
+		{"*/15 * * * *", "2026-01-01T10:07:00Z", "2026-01-01T10:15:00Z"},
+		{"@hourly", "2026-01-01T10:00:00Z", "2026-01-01T11:00:00Z"},
+		{"0 3 * * *", "2026-01-01T10:00:00Z", "2026-01-02T03:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule+" at "+tt.now, func(t *testing.T) {
+			schedule, err := cron.ParseStandard(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := nextSlot(schedule, at(tt.now)); !got.Equal(at(tt.want)) {
+				t.Errorf("nextSlot = %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Replicas asking at different times within a slot agree on it
+	every, _ := cron.ParseStandard("@every 1m")
+	if a, b := nextSlot(every, at("2026-01-01T10:00:01Z")), nextSlot(every, at("2026-01-01T10:00:59Z")); !a.Equal(b) {
+		t.Errorf("replicas disagree: %v and %v", a, b)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	run := func(ctx context.Context) error { return nil }
+	tests := []struct {
+		name    string
+		task    Task
+		wantErr bool
+	}{
+		{"valid", Task{Name: "t", Schedule: "@every 1m", Run: run}, false},
+		{"cron expression", Task{Name: "t", Schedule: "*/5 * * * *", Run: run}, false},
+		{"no name", Task{Schedule: "@every 1m", Run: run}, true},
+		{"no run", Task{Name: "t", Schedule: "@every 1m"}, true},
+		{"invalid schedule", Task{Name: "t", Schedule: "every minute", Run: run}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(nil, nil)
+			if err := s.Register(tt.task); (err != nil) != tt.wantErr {
+				t.Errorf("Register error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunSlotOncePerSlot(t *testing.T) {
+	mr := miniredis.RunT(t)
+	runs := 0
+	task := Task{Name: "t", Schedule: "@every 1m", Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}
+	// Two replicas sharing Redis
+	a, b := newTestScheduler(t, mr), newTestScheduler(t, mr)
+	for _, s := range []*Scheduler{a, b} {
+		if err := s.Register(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	slot := time.Now().Truncate(time.Minute)
+	a.runSlot(context.Background(), a.tasks["t"], slot)
+	b.runSlot(context.Background(), b.tasks["t"], slot)
+	a.runSlot(context.Background(), a.tasks["t"], slot.Add(-time.Minute))
+	if runs != 1 {
+		t.Fatalf("ran %d times for one slot, want 1", runs)
+	}
+	b.runSlot(context.Background(), b.tasks["t"], slot.Add(time.Minute))
+	if runs != 2 {
+		t.Errorf("ran %d times for two slots, want 2", runs)
+	}
+}
+
+func TestRunSlotRecordsHistory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestScheduler(t, mr)
+	tasks := []Task{
+		{Name: "ok", Schedule: "@every 1m", Run: func(ctx context.Context) error { return nil }},
+		{Name: "failing", Schedule: "@every 1m", Run: func(ctx context.Context) error { return errors.New("boom") }},
+		{Name: "panicking", Schedule: "@every 1m", Run: func(ctx context.Context) error { panic("oops") }},
+		{Name: "slow", Schedule: "@every 1m", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+	slot := time.Now().Truncate(time.Minute)
+	for _, task := range tasks {
+		if err := s.Register(task); err != nil {
+			t.Fatal(err)
+		}
+		s.runSlot(context.Background(), s.tasks[task.Name], slot)
+	}
+
+	history, err := s.History(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"ok":        "",
+		"failing":   "boom",
+		"panicking": "task panicked: oops",
+		"slow":      context.DeadlineExceeded.Error(),
+	}
+	if len(history) != len(want) {
+		t.Fatalf("History has %d entries, want %d", len(history), len(want))
+	}
+	for _, status := range history {
+		if status.Error != want[status.Name] {
+			t.Errorf("%s: error %q, want %q", status.Name, status.Error, want[status.Name])
+		}
+		if !status.Slot.Equal(slot) || status.Node != s.node || !status.NextRun.After(time.Now()) {
+			t.Errorf("%s: status %+v", status.Name, status)
+		}
+	}
+}
+
+func TestStartAndWait(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := newTestScheduler(t, mr)
+	started := make(chan struct{}, 1)
+	if err := s.Register(Task{Name: "t", Schedule: "@every 1s", Run: func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("task did not run")
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the context was cancelled")
+	}
+}
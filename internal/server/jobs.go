@@ -0,0 +1,17 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/feitian/internal/jobs"
+	"github.com/rs/zerolog/log"
+)
+
+// registerJobHandlers registers background job handlers, like registerModules does for RPC methods.
+// Handlers must be registered in every process that runs workers, which is why this lives in Server.
+func (s *Server) registerJobHandlers() {
+	s.jobs.RegisterHandler(jobs.NewHandler("log", func(ctx context.Context, payload map[string]any) error {
+		log.Info().Interface("payload", payload).Msg("log job")
+		return nil
+	}))
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/feitian/internal/api"
+)
+
+// registerModules registers the RPC modules; each serves its methods under its own namespace
+func (s *Server) registerModules() {
+	s.mustRegisterModule(api.NewAdminModule(s.Config, s.scheduler, s.apiServer.Cache()))
+}
+
+func (s *Server) mustRegisterModule(m api.Module) {
+	if err := s.apiServer.RegisterModule(context.Background(), m); err != nil {
+		panic(err)
+	}
+}
@@ -1,19 +1,154 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
 	"github.com/google/feitian/internal/api"
 	"github.com/google/feitian/internal/conf"
+	"github.com/google/feitian/internal/jobs"
+	"github.com/google/feitian/internal/middleware"
+	"github.com/google/feitian/internal/scheduler"
 	"github.com/google/feitian/internal/storage"
+	"github.com/google/feitian/pkg/common/config"
+	logs "github.com/google/feitian/pkg/common/log"
+	"github.com/rs/zerolog/log"
 )
 
 type Server struct {
 	storage   *storage.Storage
 	apiServer *api.ApiServer
 	conf      conf.Config
+	current   atomic.Pointer[conf.Config] // latest config applied by ApplyConfig
+	jobs      *jobs.Queue
+	scheduler *scheduler.Scheduler
+
+	// background is the context of the job workers and the scheduler, cancelled by Shutdown
+	background context.Context
+	stop       context.CancelFunc
+	workers    sync.WaitGroup
 }
 
 func NewServer(storage *storage.Storage, conf conf.Config) *Server {
-	return &Server{storage: storage, apiServer: api.NewApiServerWithDeps(storage, conf), conf: conf}
+	s := &Server{storage: storage, apiServer: api.NewApiServerWithDeps(storage, conf), conf: conf}
+	s.background, s.stop = context.WithCancel(context.Background())
+	s.current.Store(&conf)
+	if storage != nil && storage.GetRedis() != nil {
+		s.jobs = jobs.NewQueue(storage.GetRedis(), conf.JobsConfiguration)
+		s.registerJobHandlers()
+		s.apiServer.SetJobQueue(s.jobs)
+
+		locker, err := storage.Locker()
+		if err != nil {
+			panic(err)
+		}
+		s.scheduler = scheduler.New(locker, storage.GetRedis())
+		s.registerTasks()
+	}
+	s.registerModules()
+	return s
+}
+
+// Run starts the HTTP server, plus in-process job workers when JobsConfiguration.Workers > 0
+// and the scheduler when SchedulerConfiguration.Enabled
+func (s *Server) Run() error {
+	if s.scheduler != nil && s.conf.SchedulerConfiguration.Enabled {
+		s.scheduler.Start(s.background)
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.scheduler.Wait()
+		}()
+	}
+	if s.jobs != nil && s.conf.JobsConfiguration.Workers > 0 {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			if err := s.jobs.Run(s.background, s.conf.JobsConfiguration.Workers); err != nil {
+				log.Error().Err(err).Msg("Job workers exited")
+			}
+		}()
+	}
+	return s.apiServer.Run()
 }
 
-func (s *Server) Run() error { return s.apiServer.Run() }
+// ApplyConfig applies a reloaded configuration. Log level, rate limits and RPC timeouts/limits
+// take effect immediately; changes to other sections are only logged, as they need a restart.
+func (s *Server) ApplyConfig(old, new conf.Config) {
+	if err := logs.SetLevel(new.LoggerConfiguration.Level); err != nil {
+		log.Error().Err(err).Msg("Invalid log level")
+	}
+	if err := s.apiServer.ApplyConfig(new); err != nil {
+		log.Error().Err(err).Msg("Failed to apply config")
+	}
+	s.current.Store(&new)
+
+	restartOnly := []struct {
+		section  string
+		old, new interface{}
+	}{
+		{"ServiceConfiguration", old.ServiceConfiguration, new.ServiceConfiguration},
+		// The clients keep their connections, so a rotated password is only used after a restart
+		{"PostgresConfiguration", old.PostgresConfiguration, new.PostgresConfiguration},
+		{"RedisConfiguration", old.RedisConfiguration, new.RedisConfiguration},
+		{"LoggerConfiguration", withoutLevel(old.LoggerConfiguration), withoutLevel(new.LoggerConfiguration)},
+		{"RateLimitConfiguration.Backend", old.RateLimitConfiguration.Backend, new.RateLimitConfiguration.Backend},
+		{"JobsConfiguration", old.JobsConfiguration, new.JobsConfiguration},
+		{"SchedulerConfiguration", old.SchedulerConfiguration, new.SchedulerConfiguration},
+	}
+	for _, c := range restartOnly {
+		if !reflect.DeepEqual(c.old, c.new) {
+			log.Warn().Str("section", c.section).Msg("Config changed, restart to apply")
+		}
+	}
+	if old.PostgresConfiguration.Password != new.PostgresConfiguration.Password ||
+		old.RedisConfiguration.Password != new.RedisConfiguration.Password {
+		log.Warn().Msg("Database or Redis password rotated; connections keep the old one until restart, keep it valid until then")
+	}
+	log.Info().Msg("Config reloaded")
+}
+
+// Config returns the latest applied configuration
+func (s *Server) Config() conf.Config {
+	return *s.current.Load()
+}
+
+// SetPanicReporter replaces the reporter of recovered panics; call it before Run
+func (s *Server) SetPanicReporter(reporter middleware.PanicReporter) {
+	s.apiServer.SetPanicReporter(reporter)
+}
+
+func withoutLevel(c config.LoggerConfig) config.LoggerConfig {
+	c.Level = ""
+	return c
+}
+
+// Shutdown stops the HTTP server and runs the module shutdown hooks, then stops the job workers
+// and the scheduler and waits for them until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.apiServer.Shutdown(ctx)
+	s.stop()
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("waiting for job workers and scheduler: %w", ctx.Err()))
+	}
+	return err
+}
+
+// RunWorker runs job workers only, until ctx is cancelled
+func (s *Server) RunWorker(ctx context.Context) error {
+	if s.jobs == nil {
+		return errors.New("job queue requires redis")
+	}
+	return s.jobs.Run(ctx, max(s.conf.JobsConfiguration.Workers, 1))
+}
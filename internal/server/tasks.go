@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/feitian/internal/scheduler"
+	"github.com/rs/zerolog/log"
+)
+
+// registerTasks registers periodic tasks run by the scheduler
+func (s *Server) registerTasks() {
+	s.mustRegisterTask(scheduler.Task{
+		Name:     "jobs.dead.report",
+		Schedule: "@hourly",
+		Jitter:   time.Minute,
+		Timeout:  time.Minute,
+		Run: func(ctx context.Context) error {
+			dead, err := s.jobs.DeadJobs(ctx, 100)
+			if err != nil {
+				return err
+			}
+			if len(dead) > 0 {
+				log.Warn().Int("jobs", len(dead)).Msg("dead-letter queue is not empty")
+			}
+			return nil
+		},
+	})
+}
+
+func (s *Server) mustRegisterTask(task scheduler.Task) {
+	if err := s.scheduler.Register(task); err != nil {
+		panic(err)
+	}
+}
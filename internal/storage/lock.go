@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+var (
+	ErrLockNotAcquired = errors.New("lock is held by another owner")
+	ErrLockNotHeld     = errors.New("lock is no longer held")
+	ErrInvalidLockTTL  = errors.New("lock ttl must be at least 1s")
+)
+
+const (
+	// minLockTTL keeps the watchdog's renewal interval (a third of the ttl) workable
+	minLockTTL   = time.Second
+	lockRetryMin = 50 * time.Millisecond
+	lockRetryMax = time.Second
+)
+
+// Locker acquires named distributed locks
+// TryLock returns ErrLockNotAcquired immediately when the lock is held elsewhere;
+// Lock blocks until the lock is acquired or ctx is done.
+
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+	Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lock. A watchdog keeps it alive until Unlock;
+// Lost is closed if the lock could not be kept (expired, stolen or connection lost).
+
+type Lock interface {
+	Key() string
+	Unlock(ctx context.Context) error
+	Lost() <-chan struct{}
+}
+
+// WithLock runs fn while holding key, and cancels fn's context if the lock is lost
+func WithLock(ctx context.Context, locker Locker, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := locker.Lock(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(context.Background())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return fn(ctx)
+}
+
+// blockingLock retries tryLock with jittered exponential backoff until it succeeds or ctx is done
+func blockingLock(ctx context.Context, tryLock func() (Lock, error)) (Lock, error) {
+	wait := lockRetryMin
+	for {
+		lock, err := tryLock()
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return lock, err
+		}
+		timer := time.NewTimer(wait/2 + rand.N(wait/2))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		wait = min(wait*2, lockRetryMax)
+	}
+}
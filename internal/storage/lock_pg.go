@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// PgLocker implements Locker with Postgres session-level advisory locks.
+// Each held lock pins one pooled connection; the lock lives as long as that
+// session, so ttl only sets how often the watchdog checks the connection.
+
+type PgLocker struct {
+	db *gorm.DB
+}
+
+func NewPgLocker(db *gorm.DB) *PgLocker {
+	return &PgLocker{db: db}
+}
+
+func (l *PgLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	return l.acquire(ctx, key, ttl, "SELECT pg_try_advisory_lock($1)")
+}
+
+func (l *PgLocker) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	// pg_advisory_lock waits server-side and is cancelled together with ctx
+	return l.acquire(ctx, key, ttl, "SELECT true FROM (SELECT pg_advisory_lock($1)) AS locked")
+}
+
+func (l *PgLocker) acquire(ctx context.Context, key string, ttl time.Duration, query string) (Lock, error) {
+	if ttl < minLockTTL {
+		return nil, ErrInvalidLockTTL
+	}
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := advisoryLockID(key)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, query, id).Scan(&acquired); err != nil {
+		// The lock may have been granted just before cancellation; the session
+		// goes back to the pool on Close, so make sure it does not keep the lock
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", id)
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, ErrLockNotAcquired
+	}
+	lock := &pgLock{
+		conn: conn,
+		key:  key,
+		id:   id,
+		ttl:  ttl,
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	go lock.watchdog()
+	return lock, nil
+}
+
+type pgLock struct {
+	conn     *sql.Conn
+	key      string
+	id       int64
+	ttl      time.Duration
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (l *pgLock) Key() string { return l.key }
+
+func (l *pgLock) Lost() <-chan struct{} { return l.lost }
+
+// Unlock releases the lock and returns the session to the pool. A session that
+// may still hold the lock must not be reused, so the unlock is not cut short by
+// a cancelled ctx, and the connection is discarded if it fails anyway.
+func (l *pgLock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	defer l.conn.Close()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), l.ttl)
+	defer cancel()
+	var released bool
+	if err := l.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.id).Scan(&released); err != nil {
+		// Reporting ErrBadConn makes database/sql close the session instead of pooling it
+		_ = l.conn.Raw(func(any) error { return driver.ErrBadConn })
+		return err
+	}
+	if !released {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog pings the session holding the lock; a dead session means the lock is gone
+func (l *pgLock) watchdog() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.conn.PingContext(ctx)
+			cancel()
+			if err != nil {
+				log.Error().Err(err).Str("lock", l.key).Msg("advisory lock session lost")
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// advisoryLockID maps a lock name onto the bigint key space of advisory locks
+func advisoryLockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
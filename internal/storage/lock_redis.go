@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const redisLockPrefix = "lock:"
+
+// Both scripts only touch the key while it still holds our token, so an
+// expired lock re-acquired by someone else is never renewed or released by us.
+var (
+	renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// RedisLocker implements Locker with SET NX PX and a renewing watchdog
+
+type RedisLocker struct {
+	redis *redis.Client
+}
+
+func NewRedisLocker(redisConn *redis.Client) *RedisLocker {
+	return &RedisLocker{redis: redisConn}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	if ttl < minLockTTL {
+		return nil, ErrInvalidLockTTL
+	}
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	acquired := time.Now()
+	ok, err := l.redis.SetNX(ctx, redisLockPrefix+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	lock := &redisLock{
+		redis: l.redis,
+		key:   key,
+		token: token,
+		ttl:   ttl,
+		lost:  make(chan struct{}),
+		stop:  make(chan struct{}),
+	}
+	go lock.watchdog(acquired)
+	return lock, nil
+}
+
+func (l *RedisLocker) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	return blockingLock(ctx, func() (Lock, error) { return l.TryLock(ctx, key, ttl) })
+}
+
+type redisLock struct {
+	redis    *redis.Client
+	key      string
+	token    string
+	ttl      time.Duration
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	lostOnce sync.Once
+}
+
+func (l *redisLock) Key() string { return l.key }
+
+func (l *redisLock) Lost() <-chan struct{} { return l.lost }
+
+func (l *redisLock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	n, err := releaseLockScript.Run(ctx, l.redis, []string{redisLockPrefix + l.key}, l.token).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog extends the TTL every third of it until Unlock. The lock is marked
+// lost once the key is gone, or once renewals have failed for a whole TTL since
+// the last one that succeeded, as the key has expired on the server by then.
+func (l *redisLock) watchdog(renewed time.Time) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			// Timed before the call, the TTL set by a renewal starts no earlier
+			attempt := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			n, err := renewLockScript.Run(ctx, l.redis, []string{redisLockPrefix + l.key}, l.token, l.ttl.Milliseconds()).Int()
+			cancel()
+			if err != nil {
+				if time.Since(renewed) >= l.ttl {
+					log.Error().Err(err).Str("lock", l.key).Msg("lock expired while renewals were failing")
+					l.lostOnce.Do(func() { close(l.lost) })
+					return
+				}
+				log.Warn().Err(err).Str("lock", l.key).Msg("failed to renew lock")
+				continue
+			}
+			if n == 0 {
+				log.Error().Str("lock", l.key).Msg("lock lost before unlock")
+				l.lostOnce.Do(func() { close(l.lost) })
+				return
+			}
+			renewed = attempt
+		}
+	}
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLocker(t *testing.T) (*RedisLocker, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisLocker(client), mr
+}
+
+func TestRedisLockerTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantErr error
+	}{
+		{"zero", 0, ErrInvalidLockTTL},
+		{"negative", -time.Second, ErrInvalidLockTTL},
+		{"below the minimum", 999 * time.Millisecond, ErrInvalidLockTTL},
+		{"minimum", time.Second, nil},
+		{"long", time.Hour, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locker, _ := newTestLocker(t)
+			lock, err := locker.TryLock(context.Background(), "job", tt.ttl)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TryLock error = %v, want %v", err, tt.wantErr)
+			}
+			if lock != nil {
+				lock.Unlock(context.Background())
+			}
+		})
+	}
+}
+
+func TestRedisLockerExclusive(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	ctx := context.Background()
+	lock, err := locker.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.TryLock(ctx, "job", time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("second TryLock error = %v, want ErrLockNotAcquired", err)
+	}
+	other, err := locker.TryLock(ctx, "other", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock on another key: %v", err)
+	}
+	other.Unlock(ctx)
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if mr.Exists(redisLockPrefix + "job") {
+		t.Error("Unlock left the key behind")
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("second Unlock error = %v, want ErrLockNotHeld", err)
+	}
+	again, err := locker.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock after Unlock: %v", err)
+	}
+	again.Unlock(ctx)
+}
+
+func TestRedisLockerDoesNotReleaseForeignLock(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	ctx := context.Background()
+	lock, err := locker.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lock expired and another owner took it
+	mr.Set(redisLockPrefix+"job", "someone-else")
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Unlock error = %v, want ErrLockNotHeld", err)
+	}
+	if got, _ := mr.Get(redisLockPrefix + "job"); got != "someone-else" {
+		t.Errorf("Unlock removed the other owner's lock")
+	}
+}
+
+func TestRedisLockWatchdog(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	lock, err := locker.TryLock(context.Background(), "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock(context.Background())
+
+	mr.FastForward(800 * time.Millisecond)
+	time.Sleep(500 * time.Millisecond)
+	if ttl := mr.TTL(redisLockPrefix + "job"); ttl <= 200*time.Millisecond {
+		t.Errorf("TTL = %v, want it renewed", ttl)
+	}
+
+	mr.Del(redisLockPrefix + "job")
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lost was not closed after the key disappeared")
+	}
+}
+
+func TestRedisLockLostWhenRenewalsFail(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	lock, err := locker.TryLock(context.Background(), "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock(context.Background())
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	start := time.Now()
+	select {
+	case <-lock.Lost():
+		if waited := time.Since(start); waited < 600*time.Millisecond {
+			t.Errorf("Lost closed after %v, want it to wait for the TTL", waited)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Lost was not closed while renewals kept failing")
+	}
+}
+
+func TestRedisLockerLock(t *testing.T) {
+	locker, _ := newTestLocker(t)
+	held, err := locker.TryLock(context.Background(), "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "job", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock on a held key error = %v, want context.DeadlineExceeded", err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		held.Unlock(context.Background())
+	}()
+	lock, err := locker.Lock(context.Background(), "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	lock.Unlock(context.Background())
+}
+
+func TestWithLockCancelsOnLoss(t *testing.T) {
+	locker, mr := newTestLocker(t)
+	err := WithLock(context.Background(), locker, "job", time.Second, func(ctx context.Context) error {
+		mr.Del(redisLockPrefix + "job")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			return nil
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("WithLock error = %v, want the context cancelled once the lock is lost", err)
+	}
+}
+
+func TestStorageLockers(t *testing.T) {
+	s := NewStorage(nil, nil)
+	if _, err := s.Locker(); err == nil {
+		t.Error("Locker without redis did not fail")
+	}
+	if _, err := s.PgLocker(); err == nil {
+		t.Error("PgLocker without postgres did not fail")
+	}
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	if _, err := NewStorage(client, nil).Locker(); err != nil {
+		t.Errorf("Locker with redis: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"errors"
+
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
@@ -16,3 +18,19 @@ func NewStorage(redisConn *redis.Client, db *gorm.DB) *Storage {
 
 func (s *Storage) GetRedis() *redis.Client { return s.redis }
 func (s *Storage) GetDB() *gorm.DB { return s.db }
+
+// Locker returns a Redis-backed distributed lock helper, or an error without Redis
+func (s *Storage) Locker() (Locker, error) {
+	if s.redis == nil {
+		return nil, errors.New("storage: distributed locks need redis")
+	}
+	return NewRedisLocker(s.redis), nil
+}
+
+// PgLocker returns a Postgres advisory-lock helper with the same interface as Locker, or an error without Postgres
+func (s *Storage) PgLocker() (Locker, error) {
+	if s.db == nil {
+		return nil, errors.New("storage: advisory locks need postgres")
+	}
+	return NewPgLocker(s.db), nil
+}
@@ -13,13 +13,6 @@ import (
 )
 
 func PostgresClient(conf config.PostgresConfiguration, gormConfig *gorm.Config) (*gorm.DB, error) {
-	if conf.TimeZone == "" {
-		conf.TimeZone = "Asia/Tokyo"
-	}
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=%s", conf.Host, conf.User, conf.Password, conf.DBName, conf.Port, conf.TimeZone)
-	if !conf.SSLMode {
-		dsn += " sslmode=disable"
-	}
 	if gormConfig == nil {
 		gormConfig = &gorm.Config{
 			Logger: logger.New(
@@ -33,5 +26,13 @@ func PostgresClient(conf config.PostgresConfiguration, gormConfig *gorm.Config)
 			),
 		}
 	}
-	return gorm.Open(postgres.Open(dsn), gormConfig)
+	return gorm.Open(postgres.Open(postgresDSN(conf)), gormConfig)
+}
+
+func postgresDSN(conf config.PostgresConfiguration) string {
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d TimeZone=%s", conf.Host, conf.User, conf.Password, conf.DBName, conf.Port, conf.TimeZone)
+	if !conf.SSLMode {
+		dsn += " sslmode=disable"
+	}
+	return dsn
 }
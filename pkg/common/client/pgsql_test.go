@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/google/feitian/pkg/common/config"
+)
+
+func TestPostgresDSN(t *testing.T) {
+	base := config.PostgresConfiguration{Host: "db", User: "app", Password: "pw", DBName: "feitian", Port: 5432}
+	tests := []struct {
+		name     string
+		timeZone string
+		sslMode  bool
+		want     string
+	}{
+		{"time zone", "Asia/Tokyo", false, "host=db user=app password=pw dbname=feitian port=5432 TimeZone=Asia/Tokyo sslmode=disable"},
+		{"ssl", "UTC", true, "host=db user=app password=pw dbname=feitian port=5432 TimeZone=UTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := base
+			conf.TimeZone = tt.timeZone
+			conf.SSLMode = tt.sslMode
+			if got := postgresDSN(conf); got != tt.want {
+				t.Errorf("postgresDSN = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
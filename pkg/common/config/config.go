@@ -1,6 +1,12 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
@@ -9,64 +15,275 @@ import (
 // Mimics the layout from the reference project
 
 type PostgresConfiguration struct {
-	Host     string `mapstructure:"Host"`
-	Port     int    `mapstructure:"Port"`
-	User     string `mapstructure:"User"`
-	Password string `mapstructure:"Password"`
-	DBName   string `mapstructure:"DBName"`
+	Host     string `mapstructure:"Host" default:"127.0.0.1" validate:"required"`
+	Port     int    `mapstructure:"Port" default:"5432" validate:"min=1,max=65535"`
+	User     string `mapstructure:"User" validate:"required"`
+	Password string `mapstructure:"Password" secret:"true"`
+	DBName   string `mapstructure:"DBName" validate:"required"`
 	SSLMode  bool   `mapstructure:"SSLMode"`
-	TimeZone string `mapstructure:"TimeZone"`
+	TimeZone string `mapstructure:"TimeZone" default:"Asia/Tokyo" validate:"timezone"`
 }
 
 // ServiceConfiguration configuration for service
+// TrustedProxies: IPs or CIDRs of the reverse proxies whose X-Forwarded-For / X-Real-IP headers
+// are believed; empty trusts none, so callers are identified by the peer address (read at startup)
 
 type ServiceConfiguration struct {
-	Port  string `mapstructure:"Port"`
-	Debug bool   `mapstructure:"Debug"`
+	Port           string   `mapstructure:"Port" default:"8080" validate:"port"`
+	Debug          bool     `mapstructure:"Debug"`
+	TrustedProxies []string `mapstructure:"TrustedProxies" validate:"cidrs"`
 }
 
 // RedisConfiguration configuration for Redis
 
 type RedisConfiguration struct {
-	Addr     string `mapstructure:"Addr"`
-	Db       int    `mapstructure:"Db"`
-	Password string `mapstructure:"Password"`
+	Addr     string `mapstructure:"Addr" default:"127.0.0.1:6379" validate:"hostport"`
+	Db       int    `mapstructure:"Db" validate:"min=0"`
+	Password string `mapstructure:"Password" secret:"true"`
 }
 
 // LoggerConfig configuration for logger
+// PanicFile: recovered panics as JSON lines (see middleware.PanicReporter); empty writes them to stdout
 
 type LoggerConfig struct {
-	Filename string `mapstructure:"Filename"`
-	MaxSize  int    `mapstructure:"MaxSize"` // MB
+	Filename  string `mapstructure:"Filename" default:"./logs/app.log" validate:"required"`
+	MaxSize   int    `mapstructure:"MaxSize" default:"10" validate:"min=1"` // MB
+	Level     string `mapstructure:"Level" default:"debug" validate:"oneof=trace debug info warn error"`
+	PanicFile string `mapstructure:"PanicFile" default:"./logs/panics.log"`
+}
+
+// AuthConfiguration configuration for API clients
+// ApiKeys: keys accepted in the X-Api-Key header; a caller sending one of them is identified as
+// "key:<api key>", any other caller by its IP. Each entry may be a secret reference.
+
+type AuthConfiguration struct {
+	ApiKeys []string `mapstructure:"ApiKeys" secret:"true"`
+}
+
+// RateLimitConfiguration configuration for RPC rate limiting
+// Backend: "redis" (shared by all replicas) or "memory" (single node / dev)
+// Rules are declared as an array of tables so that method names may contain dots.
+
+type RateLimitConfiguration struct {
+	Enabled bool            `mapstructure:"Enabled"`
+	Backend string          `mapstructure:"Backend" default:"redis" validate:"oneof=redis memory"`
+	Rules   []RateLimitRule `mapstructure:"Rules"`
+}
+
+// RateLimitRule allows at most Limit calls per sliding Window for each client
+// Method: empty applies to all methods combined, otherwise only to that method
+// Principal: empty applies to every client, otherwise only to that client ("key:<api key>" for a key
+// listed in AuthConfiguration.ApiKeys, or "ip:<addr>"). It holds an API key, so it is redacted like the
+// other secrets and may be a secret reference resolving to the whole principal, e.g. a file holding "key:<api key>"
+
+type RateLimitRule struct {
+	Method    string        `mapstructure:"Method"`
+	Principal string        `mapstructure:"Principal" secret:"true"`
+	Limit     int           `mapstructure:"Limit" validate:"min=1"`
+	Window    time.Duration `mapstructure:"Window" validate:"min=1ms"`
+}
+
+// JobsConfiguration configuration for the background job queue
+// Workers: number of in-process worker goroutines started with the server (0 = enqueue only);
+// the "worker" subcommand runs workers without the HTTP server.
+// JobTimeout: deadline of a single run; 0 disables it. VisibilityTimeout only bounds how long a job
+// stays taken after its worker stops heartbeating, and each expiry counts as a failed attempt.
+// DeadTTL: how long jobs in the dead-letter queue are kept for inspection and RetryDead
+
+type JobsConfiguration struct {
+	Workers           int           `mapstructure:"Workers" validate:"min=0"`
+	MaxRetries        int           `mapstructure:"MaxRetries" default:"5" validate:"min=0"`
+	BackoffBase       time.Duration `mapstructure:"BackoffBase" default:"1s" validate:"min=1ms"`
+	BackoffMax        time.Duration `mapstructure:"BackoffMax" default:"1h" validate:"min=1ms"`
+	PollInterval      time.Duration `mapstructure:"PollInterval" default:"1s" validate:"min=10ms"`
+	VisibilityTimeout time.Duration `mapstructure:"VisibilityTimeout" default:"5m" validate:"min=1s"`
+	JobTimeout        time.Duration `mapstructure:"JobTimeout" default:"30m" validate:"min=0s"`
+	UniqueTTL         time.Duration `mapstructure:"UniqueTTL" default:"24h" validate:"min=1s"`
+	DeadTTL           time.Duration `mapstructure:"DeadTTL" default:"168h" validate:"min=1s"`
+}
+
+// SchedulerConfiguration configuration for periodic tasks
+// Every replica may enable it: a Redis lock ensures each task run happens on one replica only.
+
+type SchedulerConfiguration struct {
+	Enabled bool `mapstructure:"Enabled"`
+}
+
+// RpcConfiguration configuration for the JSON-RPC handler
+// DefaultTimeout: deadline of a call whose method does not declare its own; 0 disables it
+// MaxBodyBytes, MaxBatchSize, MaxDepth: request limits
+
+type RpcConfiguration struct {
+	DefaultTimeout time.Duration `mapstructure:"DefaultTimeout" default:"30s" validate:"min=0s"`
+	MaxBodyBytes   int64         `mapstructure:"MaxBodyBytes" default:"1048576" validate:"min=1"`
+	MaxBatchSize   int           `mapstructure:"MaxBatchSize" default:"100" validate:"min=1"`
+	MaxDepth       int           `mapstructure:"MaxDepth" default:"32" validate:"min=1"`
+}
+
+// CorsConfiguration configuration for cross-origin requests from browsers
+// AllowOrigins entries: exact ("https://app.example.com"), wildcard subdomain ("https://*.example.com"),
+// "regex:<expr>" matched against the whole origin, or "*" for any origin (not with AllowCredentials).
+// Only a matching origin is sent back; other origins get no CORS headers. Empty disables CORS.
+
+type CorsConfiguration struct {
+	AllowOrigins     []string      `mapstructure:"AllowOrigins" validate:"origins"`
+	AllowMethods     []string      `mapstructure:"AllowMethods" default:"GET,POST,OPTIONS"`
+	AllowHeaders     []string      `mapstructure:"AllowHeaders" default:"Content-Type,Authorization,X-Api-Key,Idempotency-Key,X-Request-Timeout,X-CSRF-Token"`
+	ExposeHeaders    []string      `mapstructure:"ExposeHeaders" default:"Retry-After"`
+	AllowCredentials bool          `mapstructure:"AllowCredentials"`
+	MaxAge           time.Duration `mapstructure:"MaxAge" default:"10m" validate:"min=0s"`
+}
+
+func (c CorsConfiguration) check() []string {
+	if c.AllowCredentials && slices.Contains(c.AllowOrigins, "*") {
+		return []string{`AllowOrigins: "*" cannot be combined with AllowCredentials, list the origins instead`}
+	}
+	return nil
+}
+
+// SecurityConfiguration response headers telling browsers how to treat the API; empty strings and 0 omit a header
+// HSTSMaxAge: Strict-Transport-Security, sent on HTTPS requests (TLS or X-Forwarded-Proto: https)
+// FrameOptions: X-Frame-Options, DENY or SAMEORIGIN; NoSniff: X-Content-Type-Options: nosniff
+
+type SecurityConfiguration struct {
+	HSTSMaxAge            time.Duration `mapstructure:"HSTSMaxAge" default:"8760h" validate:"min=0s"`
+	HSTSIncludeSubdomains bool          `mapstructure:"HSTSIncludeSubdomains"`
+	NoSniff               bool          `mapstructure:"NoSniff" default:"true"`
+	FrameOptions          string        `mapstructure:"FrameOptions" default:"DENY"`
+	ContentSecurityPolicy string        `mapstructure:"ContentSecurityPolicy" default:"default-src 'none'; frame-ancestors 'none'"`
+	ReferrerPolicy        string        `mapstructure:"ReferrerPolicy" default:"no-referrer"`
+}
+
+func (c SecurityConfiguration) check() []string {
+	switch c.FrameOptions {
+	case "", "DENY", "SAMEORIGIN":
+		return nil
+	}
+	return []string{fmt.Sprintf("FrameOptions: must be DENY, SAMEORIGIN or empty (got %q)", c.FrameOptions)}
+}
+
+// CsrfConfiguration protects cookie-authenticated calls against cross-site request forgery
+// Only unsafe methods (POST, ...) carrying cookies are checked; calls authenticated by headers are not affected.
+// Mode "origin": Origin (or Referer) must be this server or match CorsConfiguration.AllowOrigins (not "*")
+// Mode "token": double submit, header HeaderName must equal cookie CookieName, which the server issues
+// Mode "both": both checks; "off": none
+
+type CsrfConfiguration struct {
+	Mode       string `mapstructure:"Mode" default:"origin" validate:"oneof=off origin token both"`
+	CookieName string `mapstructure:"CookieName" default:"csrf_token" validate:"required"`
+	HeaderName string `mapstructure:"HeaderName" default:"X-CSRF-Token" validate:"required"`
+}
+
+// CompressionConfiguration compression of RPC responses, negotiated with Accept-Encoding;
+// request bodies sent with one of the Encodings are decompressed before the size limits apply
+// MinSize: smaller responses are sent uncompressed; Encodings: zstd, gzip and/or deflate, by preference
+// Level: 1 (fastest) to 9 (smallest), -1 for the library default; 0 (no compression) is rejected
+
+type CompressionConfiguration struct {
+	Enabled   bool     `mapstructure:"Enabled" default:"true"`
+	MinSize   int      `mapstructure:"MinSize" default:"1024" validate:"min=0"`
+	Level     int      `mapstructure:"Level" default:"-1" validate:"min=-1,max=9"`
+	Encodings []string `mapstructure:"Encodings" default:"zstd,gzip,deflate" validate:"min=1"`
+}
+
+func (c CompressionConfiguration) check() []string {
+	var problems []string
+	if c.Level == 0 {
+		problems = append(problems, "Level: 0 disables compression, use 1 to 9 or -1 (or set Enabled = false)")
+	}
+	for i, encoding := range c.Encodings {
+		if encoding != "zstd" && encoding != "gzip" && encoding != "deflate" {
+			problems = append(problems, fmt.Sprintf("Encodings: [%d] must be zstd, gzip or deflate (got %q)", i, encoding))
+		}
+	}
+	return problems
 }
 
 // InitConfiguration reads configuration from files and env vars
 // - configName without extension (e.g., "config")
 // - configPaths are searched in order (e.g., ./, ./configs/)
+// - config.<profile>.toml and config.local.toml are merged over the base file (see load)
+// - env vars named with DefaultEnvPrefix override file values (see setupEnv)
+// - keys set nowhere take their default tag; secret references are resolved;
+//   the result is checked against the validate tags
 
 func InitConfiguration(configName string, configPaths []string, config interface{}) error {
+	return Load(configName, configPaths, config, LoadOptions{EnvPrefix: DefaultEnvPrefix})
+}
+
+// secretResolveTimeout bounds resolving all the secret references of one load
+const secretResolveTimeout = 10 * time.Second
+
+// LoadOptions customizes Load
+// EnvPrefix: prefix of the override env vars; empty means no prefix
+// Profile: environment profile layered over the base file (see load); empty reads <EnvPrefix>_PROFILE
+// Secrets: resolves secret references (see secrets.go); nil supports file:// and env: only
+
+type LoadOptions struct {
+	EnvPrefix string
+	Profile   string
+	Secrets   *SecretResolver
+}
+
+// Load is InitConfiguration with options
+func Load(configName string, configPaths []string, config interface{}, opts LoadOptions) error {
+	_, err := load(configName, configPaths, config, opts)
+	return err
+}
+
+// load reads the layers below, each deep-merged over the previous one (tables are merged key by key,
+// arrays and values are replaced), and returns the paths of the files that were found:
+//
+//	<configName>.toml             base, shared by every environment
+//	<configName>.<profile>.toml   e.g. config.prod.toml, when a profile is selected
+//	<configName>.local.toml       developer overrides, not committed
+//
+// Each layer is searched in configPaths like the base file; missing layers are skipped.
+func load(configName string, configPaths []string, config interface{}, opts LoadOptions) ([]string, error) {
 	vp := viper.New()
-	vp.SetConfigName(configName)
-	vp.AutomaticEnv()
+	setDefaults(vp, config)
+	if err := setupEnv(vp, opts.EnvPrefix, config); err != nil {
+		return nil, err
+	}
 
 	for _, p := range configPaths {
 		vp.AddConfigPath(p)
 	}
 
-	if err := vp.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return errors.WithStack(err)
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv(envVarName(opts.EnvPrefix, "PROFILE"))
+	}
+	layers := []string{configName}
+	if profile != "" {
+		layers = append(layers, configName+"."+profile)
+	}
+	layers = append(layers, configName+".local")
+
+	var files []string
+	for _, layer := range layers {
+		vp.SetConfigName(layer)
+		if err := vp.MergeInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+				continue
+			}
+			return nil, errors.WithStack(err)
 		}
+		files = append(files, vp.ConfigFileUsed())
 	}
 
 	if err := vp.Unmarshal(config); err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
-
-	for _, key := range vp.AllKeys() {
-		if err := vp.BindEnv(key); err != nil {
-			return errors.WithStack(err)
-		}
+	secrets := opts.Secrets
+	if secrets == nil {
+		secrets = NewSecretResolver()
 	}
-	return nil
+	// A secret store that does not answer must not hang startup or a reload
+	ctx, cancel := context.WithTimeout(context.Background(), secretResolveTimeout)
+	defer cancel()
+	if err := secrets.Resolve(ctx, config); err != nil {
+		return nil, err
+	}
+	return files, Validate(config)
 }
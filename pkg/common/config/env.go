@@ -0,0 +1,93 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// DefaultEnvPrefix is prepended to every environment variable name
+const DefaultEnvPrefix = "APP"
+
+// Environment variables override file values and may set keys absent from the file.
+// The name is the prefix and the mapstructure path joined by "_", upper-cased:
+//
+//	PostgresConfiguration.Password -> APP_POSTGRESCONFIGURATION_PASSWORD
+//	JobsConfiguration.BackoffMax   -> APP_JOBSCONFIGURATION_BACKOFFMAX=30s
+//
+// Slices of structs (e.g. RateLimitConfiguration.Rules) can only be set from files.
+
+func setupEnv(vp *viper.Viper, prefix string, config interface{}) error {
+	vp.SetEnvPrefix(prefix)
+	vp.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	vp.AutomaticEnv()
+	// AutomaticEnv only covers keys viper already knows, so bind every key of the target struct
+	var err error
+	walkKeys(reflect.TypeOf(config), "", func(key string, _ reflect.StructField) {
+		if err == nil {
+			err = vp.BindEnv(key)
+		}
+	})
+	return errors.WithStack(err)
+}
+
+// envVarName returns the variable viper reads for key under prefix
+func envVarName(prefix, key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// walkKeys calls fn with the dotted mapstructure path of every leaf field of t.
+// Slices of structs are not descended into: they are set as a whole.
+func walkKeys(t reflect.Type, parent string, fn func(key string, field reflect.StructField)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		key := name
+		if parent != "" {
+			key = parent + "." + name
+		}
+		if isNested(field.Type) {
+			walkKeys(field.Type, key, fn)
+			continue
+		}
+		fn(key, field)
+	}
+}
+
+// fieldKey returns the config key of a struct field, or false if it is not part of the config
+func fieldKey(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+func isNested(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type envTestConfig struct {
+	Postgres struct {
+		Host     string `mapstructure:"Host" default:"127.0.0.1"`
+		Port     int    `mapstructure:"Port" default:"5432"`
+		Password string `mapstructure:"Password" secret:"true"`
+	} `mapstructure:"PostgresConfiguration"`
+	Jobs struct {
+		Retry struct {
+			BackoffMax time.Duration `mapstructure:"BackoffMax" default:"1h"`
+		} `mapstructure:"Retry"`
+	} `mapstructure:"JobsConfiguration"`
+}
+
+func TestEnvVarName(t *testing.T) {
+	tests := []struct {
+		prefix, key, want string
+	}{
+		{"APP", "PostgresConfiguration.Password", "APP_POSTGRESCONFIGURATION_PASSWORD"},
+		{"ft", "JobsConfiguration.Retry.BackoffMax", "FT_JOBSCONFIGURATION_RETRY_BACKOFFMAX"},
+		{"", "PostgresConfiguration.Host", "POSTGRESCONFIGURATION_HOST"},
+	}
+	for _, tt := range tests {
+		if got := envVarName(tt.prefix, tt.key); got != tt.want {
+			t.Errorf("envVarName(%q, %q) = %q, want %q", tt.prefix, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir := t.TempDir()
+	file := "[PostgresConfiguration]\nHost = \"file-host\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		prefix       string
+		env          map[string]string
+		wantHost     string
+		wantPort     int
+		wantPassword string
+		wantBackoff  time.Duration
+	}{
+		{"file and defaults", "APP", nil, "file-host", 5432, "", time.Hour},
+		{"key missing from the file", "APP", map[string]string{"APP_POSTGRESCONFIGURATION_PASSWORD": "s3cret"}, "file-host", 5432, "s3cret", time.Hour},
+		{"overrides the file", "APP", map[string]string{"APP_POSTGRESCONFIGURATION_HOST": "env-host"}, "env-host", 5432, "", time.Hour},
+		{"overrides a default", "APP", map[string]string{"APP_POSTGRESCONFIGURATION_PORT": "6432"}, "file-host", 6432, "", time.Hour},
+		{"nested key", "APP", map[string]string{"APP_JOBSCONFIGURATION_RETRY_BACKOFFMAX": "30s"}, "file-host", 5432, "", 30 * time.Second},
+		{"custom prefix", "FT", map[string]string{
+			"FT_POSTGRESCONFIGURATION_PASSWORD":  "from-ft",
+			"APP_POSTGRESCONFIGURATION_PASSWORD": "from-app",
+		}, "file-host", 5432, "from-ft", time.Hour},
+		{"no prefix", "", map[string]string{"POSTGRESCONFIGURATION_PASSWORD": "bare"}, "file-host", 5432, "bare", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			var conf envTestConfig
+			if err := Load("config", []string{dir}, &conf, LoadOptions{EnvPrefix: tt.prefix}); err != nil {
+				t.Fatal(err)
+			}
+			if conf.Postgres.Host != tt.wantHost || conf.Postgres.Port != tt.wantPort || conf.Postgres.Password != tt.wantPassword {
+				t.Errorf("PostgresConfiguration = %+v, want host %q, port %d, password %q", conf.Postgres, tt.wantHost, tt.wantPort, tt.wantPassword)
+			}
+			if conf.Jobs.Retry.BackoffMax != tt.wantBackoff {
+				t.Errorf("BackoffMax = %v, want %v", conf.Jobs.Retry.BackoffMax, tt.wantBackoff)
+			}
+		})
+	}
+}
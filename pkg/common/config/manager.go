@@ -0,0 +1,142 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadDebounce collapses the burst of events an editor or a ConfigMap update produces
+const reloadDebounce = 200 * time.Millisecond
+
+// Manager holds the current configuration and reloads it when the file changes.
+// A reload builds a new T from scratch (file, env, defaults, secrets, validation) and
+// swaps it in atomically; an invalid reload is logged and the current config kept.
+
+type Manager[T any] struct {
+	configName  string
+	configPaths []string
+	opts        LoadOptions
+
+	current     atomic.Pointer[T]
+	files       []string
+	mu          sync.Mutex // serializes reloads and guards subscribers
+	subscribers []func(old, new *T)
+}
+
+// NewManager loads the initial configuration; it fails like Load does
+func NewManager[T any](configName string, configPaths []string, opts LoadOptions) (*Manager[T], error) {
+	if opts.Secrets == nil {
+		opts.Secrets = NewSecretResolver()
+	}
+	m := &Manager[T]{configName: configName, configPaths: configPaths, opts: opts}
+	config := new(T)
+	files, err := load(configName, configPaths, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	m.files = files
+	m.current.Store(config)
+	return m, nil
+}
+
+// Get returns the current configuration; callers must not modify it
+func (m *Manager[T]) Get() *T {
+	return m.current.Load()
+}
+
+// Subscribe registers fn to be called after every reload that changed the configuration.
+// Subscribers run in registration order on the reloading goroutine.
+func (m *Manager[T]) Subscribe(fn func(old, new *T)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Reload reads the configuration again. On error the current configuration stays in place.
+func (m *Manager[T]) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	config := new(T)
+	if _, err := load(m.configName, m.configPaths, config, m.opts); err != nil {
+		return err
+	}
+	old := m.current.Load()
+	if reflect.DeepEqual(old, config) {
+		return nil
+	}
+	m.current.Store(config)
+	for _, fn := range m.subscribers {
+		fn(old, config)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever one of its files changes, until ctx is done.
+// The directories are watched rather than the files, so that editors replacing a file,
+// Kubernetes ConfigMap symlink swaps and a newly created local layer are all noticed.
+func (m *Manager[T]) Watch(ctx context.Context) error {
+	if len(m.files) == 0 {
+		return errors.New("config: no config file to watch")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer watcher.Close()
+	watched := make(map[string]bool)
+	for _, file := range m.files {
+		dir := filepath.Dir(file)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return errors.WithStack(err)
+		}
+		watched[dir] = true
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Config layers, or the "..data" symlink Kubernetes swaps on update
+			name := filepath.Base(event.Name)
+			if !strings.HasPrefix(name, m.configName+".") && !strings.HasPrefix(name, "..") {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) != 0 {
+				debounce = time.After(reloadDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warn().Err(err).Msg("config watcher error")
+		case <-debounce:
+			debounce = nil
+			if err := m.Reload(); err != nil {
+				log.Error().Err(err).Strs("files", m.files).Msg("config reload rejected, keeping the current config")
+			}
+		}
+	}
+}
+
+// Secrets returns the resolver used by the manager, e.g. to watch mounted secret files
+func (m *Manager[T]) Secrets() *SecretResolver {
+	return m.opts.Secrets
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type managerTestConfig struct {
+	Name  string `mapstructure:"Name" validate:"required"`
+	Limit int    `mapstructure:"Limit" default:"1" validate:"min=1"`
+}
+
+func writeConfig(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "Name = \"a\"\nLimit = 1\n")
+	m, err := NewManager[managerTestConfig]("config", []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct{ old, new managerTestConfig }
+	var changes []change
+	m.Subscribe(func(old, new *managerTestConfig) { changes = append(changes, change{*old, *new}) })
+	others := 0
+	m.Subscribe(func(_, _ *managerTestConfig) { others++ })
+
+	writeConfig(t, dir, "Name = \"a\"\nLimit = 2\n")
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	want := change{managerTestConfig{"a", 1}, managerTestConfig{"a", 2}}
+	if len(changes) != 1 || changes[0] != want || others != 1 {
+		t.Fatalf("changes = %+v, want one notification %+v to every subscriber", changes, want)
+	}
+	if got := *m.Get(); got != want.new {
+		t.Errorf("Get = %+v, want %+v", got, want.new)
+	}
+
+	// Invalid files are rejected and the current config kept
+	for _, content := range []string{"Name = \"a\"\nLimit = 0\n", "Limit = 3\n", "Name = \"a\"\nLimit = \n"} {
+		writeConfig(t, dir, content)
+		if err := m.Reload(); err == nil {
+			t.Errorf("Reload accepted %q", content)
+		}
+	}
+	writeConfig(t, dir, "Name = \"a\"\nLimit = 0\n")
+	var verr *ValidationError
+	if err := m.Reload(); !errors.As(err, &verr) {
+		t.Errorf("Reload = %v, want a *ValidationError", err)
+	}
+	if got := *m.Get(); got != want.new {
+		t.Errorf("Get = %+v after rejected reloads, want %+v kept", got, want.new)
+	}
+
+	// An unchanged config does not notify
+	writeConfig(t, dir, "# reformatted\nLimit = 2\nName = \"a\"\n")
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("changes = %+v, want no notification for an unchanged config", changes)
+	}
+}
+
+func TestNewManagerRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "Limit = 2\n")
+	if _, err := NewManager[managerTestConfig]("config", []string{dir}, LoadOptions{}); err == nil {
+		t.Error("NewManager accepted a config missing a required key")
+	}
+}
+
+func TestManagerWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "Name = \"a\"\n")
+	m, err := NewManager[managerTestConfig]("config", []string{dir}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan int, 1)
+	m.Subscribe(func(_, new *managerTestConfig) { reloaded <- new.Limit })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	writeConfig(t, dir, "Name = \"a\"\nLimit = 5\n")
+	select {
+	case limit := <-reloaded:
+		if limit != 5 {
+			t.Errorf("Limit = %d, want 5", limit)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("file change was not reloaded")
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type profileTestConfig struct {
+	Name string `mapstructure:"Name"`
+	Db   struct {
+		Host    string `mapstructure:"Host"`
+		Port    int    `mapstructure:"Port"`
+		Options struct {
+			Timeout string `mapstructure:"Timeout"`
+			Pool    int    `mapstructure:"Pool"`
+		} `mapstructure:"Options"`
+	} `mapstructure:"Db"`
+	Tags []string `mapstructure:"Tags"`
+}
+
+func TestLoadProfiles(t *testing.T) {
+	base := `Name = "base"
+Tags = ["a", "b"]
+[Db]
+Host = "db"
+Port = 5432
+[Db.Options]
+Timeout = "5s"
+Pool = 10
+`
+	prod := `Name = "prod"
+Tags = ["p"]
+[Db]
+Host = "prod-db"
+[Db.Options]
+Pool = 50
+`
+	staging := "Name = \"staging\"\n"
+	local := "[Db]\nPort = 6432\n"
+
+	type want struct {
+		name, host string
+		port       int
+		timeout    string
+		pool       int
+		tags       []string
+		layers     []string
+	}
+	tests := []struct {
+		name    string
+		files   map[string]string
+		profile string // LoadOptions.Profile, as set by the -profile flag
+		env     string // APP_PROFILE
+		want    want
+	}{
+		{"base only", map[string]string{"config.toml": base}, "", "",
+			want{"base", "db", 5432, "5s", 10, []string{"a", "b"}, []string{"config.toml"}}},
+		{"profile deep-merges tables", map[string]string{"config.toml": base, "config.prod.toml": prod}, "prod", "",
+			want{"prod", "prod-db", 5432, "5s", 50, []string{"p"}, []string{"config.toml", "config.prod.toml"}}},
+		{"local over profile over base", map[string]string{"config.toml": base, "config.prod.toml": prod, "config.local.toml": local}, "prod", "",
+			want{"prod", "prod-db", 6432, "5s", 50, []string{"p"}, []string{"config.toml", "config.prod.toml", "config.local.toml"}}},
+		{"local without a profile", map[string]string{"config.toml": base, "config.prod.toml": prod, "config.local.toml": local}, "", "",
+			want{"base", "db", 6432, "5s", 10, []string{"a", "b"}, []string{"config.toml", "config.local.toml"}}},
+		{"missing profile file", map[string]string{"config.toml": base}, "dev", "",
+			want{"base", "db", 5432, "5s", 10, []string{"a", "b"}, []string{"config.toml"}}},
+		{"profile from env", map[string]string{"config.toml": base, "config.prod.toml": prod}, "", "prod",
+			want{"prod", "prod-db", 5432, "5s", 50, []string{"p"}, []string{"config.toml", "config.prod.toml"}}},
+		{"flag wins over env", map[string]string{"config.toml": base, "config.prod.toml": prod, "config.staging.toml": staging}, "staging", "prod",
+			want{"staging", "db", 5432, "5s", 10, []string{"a", "b"}, []string{"config.toml", "config.staging.toml"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("APP_PROFILE", tt.env)
+
+			var conf profileTestConfig
+			files, err := load("config", []string{dir}, &conf, LoadOptions{EnvPrefix: "APP", Profile: tt.profile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := want{conf.Name, conf.Db.Host, conf.Db.Port, conf.Db.Options.Timeout, conf.Db.Options.Pool, conf.Tags, nil}
+			for _, file := range files {
+				got.layers = append(got.layers, filepath.Base(file))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loaded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// RedactedValue replaces the value of every non-empty field tagged secret:"true" (each element of a []string)
+const RedactedValue = "******"
+
+// Redact returns a copy of config with its secret fields replaced by RedactedValue.
+// config may be a struct or a pointer to one; the original is not modified.
+func Redact(config interface{}) interface{} {
+	v := reflect.ValueOf(config)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return config
+		}
+		v = v.Elem()
+	}
+	out := reflect.New(v.Type()).Elem()
+	out.Set(v)
+	redactValue(out)
+	return out.Interface()
+}
+
+// Dump renders config as indented JSON with its secrets redacted, e.g. for a startup banner
+func Dump(config interface{}) ([]byte, error) {
+	return json.MarshalIndent(Redact(config), "", "  ")
+}
+
+// redactValue redacts the addressable copy v in place; slices are copied before their
+// elements are touched, since they share their backing array with the original
+func redactValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			field := v.Field(i)
+			if t.Field(i).Tag.Get("secret") == "true" {
+				if !field.IsZero() {
+					switch {
+					case field.Kind() == reflect.String:
+						field.SetString(RedactedValue)
+					case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+						// Keep the length, so that the dump still shows how many were set
+						redacted := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+						for j := 0; j < redacted.Len(); j++ {
+							redacted.Index(j).SetString(RedactedValue)
+						}
+						field.Set(redacted)
+					default:
+						field.Set(reflect.Zero(field.Type()))
+					}
+				}
+				continue
+			}
+			redactValue(field)
+		}
+	case reflect.Slice:
+		if v.IsNil() || !hasSecrets(v.Type().Elem()) {
+			return
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := 0; i < copied.Len(); i++ {
+			redactValue(copied.Index(i))
+		}
+		v.Set(copied)
+	case reflect.Pointer:
+		if v.IsNil() || !hasSecrets(v.Type().Elem()) {
+			return
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(v.Elem())
+		redactValue(copied.Elem())
+		v.Set(copied)
+	}
+}
+
+func hasSecrets(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice:
+		return hasSecrets(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Tag.Get("secret") == "true" || hasSecrets(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+type redactTestConfig struct {
+	Name     string
+	Password string   `secret:"true"`
+	Empty    string   `secret:"true"`
+	Keys     []string `secret:"true"`
+	Port     int      `secret:"true"`
+	Nested   struct {
+		Token string `secret:"true"`
+	}
+	Items []struct {
+		Token string `secret:"true"`
+	}
+	Pointer *struct {
+		Token string `secret:"true"`
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var c redactTestConfig
+	c.Name = "app"
+	c.Password = "pw"
+	c.Keys = []string{"k1", "k2"}
+	c.Port = 5432
+	c.Nested.Token = "nested"
+	c.Items = append(c.Items, struct {
+		Token string `secret:"true"`
+	}{Token: "item"})
+	c.Pointer = &struct {
+		Token string `secret:"true"`
+	}{Token: "pointer"}
+
+	redacted := Redact(&c).(redactTestConfig)
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"plain field kept", redacted.Name, "app"},
+		{"secret string", redacted.Password, RedactedValue},
+		{"empty secret stays empty", redacted.Empty, ""},
+		{"secret slice keeps its length", strings.Join(redacted.Keys, ","), RedactedValue + "," + RedactedValue},
+		{"non-string secret is zeroed", redacted.Port, 0},
+		{"nested struct", redacted.Nested.Token, RedactedValue},
+		{"slice of structs", redacted.Items[0].Token, RedactedValue},
+		{"pointer", redacted.Pointer.Token, RedactedValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	// The original, including the backing arrays and pointees it shares with the copy, is untouched
+	if c.Password != "pw" || c.Keys[0] != "k1" || c.Items[0].Token != "item" || c.Pointer.Token != "pointer" {
+		t.Errorf("Redact modified the original: %+v", c)
+	}
+}
+
+func TestDumpHidesSecrets(t *testing.T) {
+	dump, err := Dump(PostgresConfiguration{User: "root", Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dump), "hunter2") || !strings.Contains(string(dump), RedactedValue) {
+		t.Errorf("Dump = %s", dump)
+	}
+}
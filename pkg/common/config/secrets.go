@@ -0,0 +1,238 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fields tagged secret:"true" may hold a reference instead of the secret itself;
+// Load replaces it with the resolved value before validation:
+//
+//	file:///run/secrets/db_password   contents of the file, trailing newline removed
+//	env:DB_PASSWORD                   value of the environment variable
+//	<scheme>:<ref>                    resolved by the SecretProvider registered for scheme
+//
+// Any other value is used as is.
+
+// SecretProvider resolves the references of one scheme, e.g. "vault" for "vault:secret/db#password"
+
+type SecretProvider interface {
+	Scheme() string
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretRef is a reference found in the configuration
+// Key: dotted config key of the field; Ref: the reference as written, e.g. "file:///run/secrets/db"
+
+type SecretRef struct {
+	Key string
+	Ref string
+}
+
+// SecretResolver resolves secret references and remembers them, so that mounted files can be watched
+
+type SecretResolver struct {
+	providers map[string]SecretProvider
+
+	mu   sync.Mutex
+	refs []SecretRef
+}
+
+// NewSecretResolver returns a resolver for file:// and env: plus the given providers
+func NewSecretResolver(providers ...SecretProvider) *SecretResolver {
+	r := &SecretResolver{providers: make(map[string]SecretProvider)}
+	for _, p := range append([]SecretProvider{fileProvider{}, envProvider{}}, providers...) {
+		r.providers[p.Scheme()] = p
+	}
+	return r
+}
+
+// Refs returns the references resolved by the last call to Resolve
+func (r *SecretResolver) Refs() []SecretRef {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SecretRef(nil), r.refs...)
+}
+
+// Resolve replaces the references held by the secret fields of config (a pointer to a struct)
+// and returns a *ValidationError listing every reference that could not be resolved
+func (r *SecretResolver) Resolve(ctx context.Context, config interface{}) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("config: Resolve needs a non-nil pointer, got %T", config)
+	}
+	var refs []SecretRef
+	var problems []string
+	r.resolveValue(ctx, v.Elem(), "", &refs, &problems)
+
+	r.mu.Lock()
+	r.refs = refs
+	r.mu.Unlock()
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (r *SecretResolver) resolveValue(ctx context.Context, v reflect.Value, key string, refs *[]SecretRef, problems *[]string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			r.resolveValue(ctx, v.Elem(), key, refs, problems)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.resolveValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", key, i), refs, problems)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldKey(t.Field(i))
+			if !ok {
+				continue
+			}
+			childKey := name
+			if key != "" {
+				childKey = key + "." + name
+			}
+			field := v.Field(i)
+			if t.Field(i).Tag.Get("secret") != "true" {
+				r.resolveValue(ctx, field, childKey, refs, problems)
+				continue
+			}
+			switch {
+			case field.Kind() == reflect.String:
+				r.resolveString(ctx, field, childKey, refs, problems)
+			case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+				for j := 0; j < field.Len(); j++ {
+					r.resolveString(ctx, field.Index(j), fmt.Sprintf("%s[%d]", childKey, j), refs, problems)
+				}
+			default:
+				r.resolveValue(ctx, field, childKey, refs, problems)
+			}
+		}
+	}
+}
+
+// resolveString replaces the reference held by the secret string v, if it is one
+func (r *SecretResolver) resolveString(ctx context.Context, v reflect.Value, key string, refs *[]SecretRef, problems *[]string) {
+	provider, ref, ok := r.provider(v.String())
+	if !ok {
+		return
+	}
+	value, err := provider.Resolve(ctx, ref)
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s: %v", key, err))
+		return
+	}
+	*refs = append(*refs, SecretRef{Key: key, Ref: v.String()})
+	v.SetString(value)
+}
+
+// provider returns the provider for value and the reference without its scheme
+func (r *SecretResolver) provider(value string) (SecretProvider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, "", false
+	}
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return nil, "", false
+	}
+	if scheme == "file" {
+		ref = strings.TrimPrefix(ref, "//")
+	}
+	return provider, ref, true
+}
+
+// WatchFiles re-reads the file:// references every interval until ctx is done and calls onChange
+// with the new value when a file changed, e.g. after Kubernetes rotated a mounted secret
+func (r *SecretResolver) WatchFiles(ctx context.Context, interval time.Duration, onChange func(ref SecretRef, value string)) {
+	last := make(map[string][]byte)
+	read := func(ref SecretRef) ([]byte, bool) {
+		_, path, _ := r.provider(ref.Ref)
+		data, err := os.ReadFile(path)
+		return data, err == nil
+	}
+	for _, ref := range r.Refs() {
+		if strings.HasPrefix(ref.Ref, "file:") {
+			if data, ok := read(ref); ok {
+				last[ref.Ref] = data
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, ref := range r.Refs() {
+			if !strings.HasPrefix(ref.Ref, "file:") {
+				continue
+			}
+			// A missing file is usually the middle of an atomic swap; keep the last value
+			data, ok := read(ref)
+			if !ok || bytes.Equal(data, last[ref.Ref]) {
+				continue
+			}
+			last[ref.Ref] = data
+			onChange(ref, trimSecret(data))
+		}
+	}
+}
+
+type fileProvider struct{}
+
+func (fileProvider) Scheme() string { return "file" }
+
+func (fileProvider) Resolve(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file: %w", err)
+	}
+	return trimSecret(data), nil
+}
+
+type envProvider struct{}
+
+func (envProvider) Scheme() string { return "env" }
+
+func (envProvider) Resolve(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("secret env var %s is not set", name)
+	}
+	return value, nil
+}
+
+// StaticSecretProvider serves secrets from a map, e.g. as a local stand-in for a secret store
+
+type StaticSecretProvider struct {
+	SchemeName string
+	Values     map[string]string
+}
+
+func (p *StaticSecretProvider) Scheme() string { return p.SchemeName }
+
+func (p *StaticSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	value, ok := p.Values[ref]
+	if !ok {
+		return "", fmt.Errorf("secret %s:%s not found", p.SchemeName, ref)
+	}
+	return value, nil
+}
+
+// trimSecret drops the trailing newline most tools write at the end of a secret file
+func trimSecret(data []byte) string {
+	return strings.TrimRight(string(data), "\r\n")
+}
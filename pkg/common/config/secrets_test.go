@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type secretsTestConfig struct {
+	Db struct {
+		Host     string `mapstructure:"Host"`
+		Password string `mapstructure:"Password" secret:"true"`
+	} `mapstructure:"Db"`
+	Keys    []string `mapstructure:"Keys" secret:"true"`
+	Plain   string   `mapstructure:"Plain"`
+	Backend *struct {
+		Token string `mapstructure:"Token" secret:"true"`
+	} `mapstructure:"Backend"`
+}
+
+func writeSecret(t *testing.T, name, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("FEITIAN_TEST_KEY", "from-env")
+	file := writeSecret(t, "db_password", "from-file\n")
+	vault := &StaticSecretProvider{SchemeName: "vault", Values: map[string]string{"backend#token": "from-vault"}}
+
+	var conf secretsTestConfig
+	conf.Db.Host = "env:FEITIAN_TEST_KEY"
+	conf.Db.Password = "file://" + file
+	conf.Keys = []string{"env:FEITIAN_TEST_KEY", "literal", "https://not-a-scheme"}
+	conf.Plain = "env:FEITIAN_TEST_KEY"
+	conf.Backend = &struct {
+		Token string `mapstructure:"Token" secret:"true"`
+	}{Token: "vault:backend#token"}
+
+	r := NewSecretResolver(vault)
+	if err := r.Resolve(context.Background(), &conf); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{
+		"Db.Host":       conf.Db.Host,
+		"Db.Password":   conf.Db.Password,
+		"Keys[0]":       conf.Keys[0],
+		"Keys[1]":       conf.Keys[1],
+		"Keys[2]":       conf.Keys[2],
+		"Plain":         conf.Plain,
+		"Backend.Token": conf.Backend.Token,
+	}
+	want := map[string]string{
+		"Db.Host":       "env:FEITIAN_TEST_KEY", // not tagged secret
+		"Db.Password":   "from-file",
+		"Keys[0]":       "from-env",
+		"Keys[1]":       "literal",
+		"Keys[2]":       "https://not-a-scheme",
+		"Plain":         "env:FEITIAN_TEST_KEY",
+		"Backend.Token": "from-vault",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolved %v, want %v", got, want)
+	}
+	wantRefs := []SecretRef{
+		{Key: "Db.Password", Ref: "file://" + file},
+		{Key: "Keys[0]", Ref: "env:FEITIAN_TEST_KEY"},
+		{Key: "Backend.Token", Ref: "vault:backend#token"},
+	}
+	if refs := r.Refs(); !reflect.DeepEqual(refs, wantRefs) {
+		t.Errorf("Refs = %v, want %v", refs, wantRefs)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	var conf secretsTestConfig
+	conf.Db.Password = "file:///nonexistent/secret"
+	conf.Keys = []string{"env:FEITIAN_TEST_UNSET", "vault:missing"}
+	r := NewSecretResolver(&StaticSecretProvider{SchemeName: "vault"})
+
+	err := r.Resolve(context.Background(), &conf)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 3 {
+		t.Fatalf("Resolve = %v, want a ValidationError with 3 problems", err)
+	}
+	for i, prefix := range []string{"Db.Password: ", "Keys[0]: ", "Keys[1]: "} {
+		if !strings.HasPrefix(verr.Problems[i], prefix) {
+			t.Errorf("problem %q, want it to start with %q", verr.Problems[i], prefix)
+		}
+	}
+	if conf.Db.Password != "file:///nonexistent/secret" {
+		t.Errorf("an unresolved reference was replaced with %q", conf.Db.Password)
+	}
+	if err := r.Resolve(context.Background(), conf); err == nil {
+		t.Error("Resolve accepted a non-pointer")
+	}
+}
+
+// blockingProvider answers only when its context is done
+type blockingProvider struct{}
+
+func (blockingProvider) Scheme() string { return "slow" }
+
+func (blockingProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestResolveSecretsHonoursContext(t *testing.T) {
+	var conf secretsTestConfig
+	conf.Db.Password = "slow:db"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := NewSecretResolver(blockingProvider{}).Resolve(ctx, &conf)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Resolve = %v, want the provider to give up with the context", err)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	path := writeSecret(t, "db_password", "v1\n")
+	var conf secretsTestConfig
+	conf.Db.Password = "file://" + path
+	r := NewSecretResolver()
+	if err := r.Resolve(context.Background(), &conf); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 4)
+	go r.WatchFiles(ctx, 10*time.Millisecond, func(ref SecretRef, value string) {
+		changes <- ref.Key + "=" + value
+	})
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case change := <-changes:
+		t.Fatalf("unchanged file reported as %s", change)
+	default:
+	}
+
+	if err := os.WriteFile(path, []byte("v2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case change := <-changes:
+		if change != "Db.Password=v2" {
+			t.Errorf("change = %s, want Db.Password=v2", change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rotated file was not reported")
+	}
+}
+
+func TestRateLimitPrincipalIsSecret(t *testing.T) {
+	file := writeSecret(t, "vip", "key:vip-api-key\n")
+	conf := RateLimitConfiguration{Rules: []RateLimitRule{
+		{Principal: "key:plain-api-key", Limit: 1, Window: time.Second},
+		{Principal: "file://" + file, Limit: 1, Window: time.Second},
+		{Principal: "ip:192.0.2.7", Limit: 1, Window: time.Second},
+	}}
+	if err := NewSecretResolver().Resolve(context.Background(), &conf); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"key:plain-api-key", "key:vip-api-key", "ip:192.0.2.7"}
+	for i, rule := range conf.Rules {
+		if rule.Principal != want[i] {
+			t.Errorf("rule %d: Principal = %q, want %q", i, rule.Principal, want[i])
+		}
+	}
+
+	dump, err := Dump(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dump), "api-key") {
+		t.Errorf("dump shows an API key:\n%s", dump)
+	}
+}
@@ -0,0 +1,9 @@
+package config
+
+import _ "embed"
+
+// RedactSource is the source of redact.go. Projects generated by ftinit get a copy of it,
+// so that their startup dump hides secrets the same way as this one.
+//
+//go:embed redact.go
+var RedactSource string
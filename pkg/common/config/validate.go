@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// Embedded zone database, so the timezone rule does not depend on the image having tzdata
+	_ "time/tzdata"
+
+	"github.com/spf13/viper"
+)
+
+// Config structs declare defaults and constraints with struct tags:
+//
+//	default:"5432"                    used when neither the file nor the environment sets the key
+//	validate:"required,min=1,max=65535"
+//
+// Rules (comma separated):
+//
+//	required       must not be the zero value
+//	min=N, max=N   bounds of a number, a duration ("1s") or the length of a string/slice
+//	oneof=a b c    one of the space separated values
+//	port           a string holding a TCP port (1-65535)
+//	hostport       "host:port"
+//	timezone       an IANA time zone name
+//	cidrs          IP addresses or CIDR ranges
+//	origins        CORS origins, see CorsConfiguration
+//
+// Slices of structs are validated element by element. Constraints spanning several fields
+// are implemented by the struct's check method (see checker).
+
+// ValidationError lists every problem found in a configuration
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// checker is implemented by config structs with constraints spanning several fields;
+// check returns the problems, prefixed with the field names
+type checker interface {
+	check() []string
+}
+
+// setDefaults registers the default tag values of config with viper
+func setDefaults(vp *viper.Viper, config interface{}) {
+	walkKeys(reflect.TypeOf(config), "", func(key string, field reflect.StructField) {
+		if value, ok := field.Tag.Lookup("default"); ok {
+			vp.SetDefault(key, value)
+		}
+	})
+}
+
+// Validate checks config against its validate tags and returns a *ValidationError listing every problem
+func Validate(config interface{}) error {
+	v := reflect.ValueOf(config)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var problems []string
+	validateStruct(v, "", &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, parent string, problems *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		key := name
+		if parent != "" {
+			key = parent + "." + name
+		}
+		value := v.Field(i)
+		if isNested(field.Type) {
+			if value.Kind() == reflect.Pointer {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			validateStruct(value, key, problems)
+			continue
+		}
+		if rules := field.Tag.Get("validate"); rules != "" {
+			for _, rule := range strings.Split(rules, ",") {
+				if msg := checkRule(strings.TrimSpace(rule), value); msg != "" {
+					*problems = append(*problems, fmt.Sprintf("%s: %s", key, msg))
+				}
+			}
+		}
+		if value.Kind() == reflect.Slice && isNested(value.Type().Elem()) {
+			for j := 0; j < value.Len(); j++ {
+				validateStruct(reflect.Indirect(value.Index(j)), fmt.Sprintf("%s[%d]", key, j), problems)
+			}
+		}
+	}
+	if c, ok := v.Interface().(checker); ok {
+		for _, msg := range c.check() {
+			if parent != "" {
+				msg = parent + "." + msg
+			}
+			*problems = append(*problems, msg)
+		}
+	}
+}
+
+// checkRule returns a description of the violation, or "" if value satisfies rule
+func checkRule(rule string, value reflect.Value) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		return checkBound(name, arg, value)
+	case "oneof":
+		options := strings.Fields(arg)
+		got := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if got == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s (got %q)", strings.Join(options, ", "), got)
+	case "port":
+		port, err := strconv.Atoi(value.String())
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Sprintf("must be a port between 1 and 65535 (got %q)", value.String())
+		}
+	case "hostport":
+		if _, port, err := net.SplitHostPort(value.String()); err != nil || port == "" {
+			return fmt.Sprintf("must be host:port (got %q)", value.String())
+		}
+	case "timezone":
+		if _, err := time.LoadLocation(value.String()); err != nil || value.String() == "" {
+			return fmt.Sprintf("unknown time zone %q", value.String())
+		}
+	case "cidrs":
+		var msgs []string
+		for i := 0; i < value.Len(); i++ {
+			entry := value.Index(i).String()
+			if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+				msgs = append(msgs, fmt.Sprintf("[%d] must be an IP address or CIDR range (got %q)", i, entry))
+			}
+		}
+		return strings.Join(msgs, "; ")
+	case "origins":
+		var msgs []string
+		for i := 0; i < value.Len(); i++ {
+			if msg := checkOrigin(value.Index(i).String()); msg != "" {
+				msgs = append(msgs, fmt.Sprintf("[%d] %s", i, msg))
+			}
+		}
+		return strings.Join(msgs, "; ")
+	default:
+		return fmt.Sprintf("unknown validation rule %q", rule)
+	}
+	return ""
+}
+
+func checkBound(name, arg string, value reflect.Value) string {
+	var got, bound float64
+	var display string
+	switch {
+	case value.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return fmt.Sprintf("invalid %s bound %q", name, arg)
+		}
+		got, bound, display = float64(value.Int()), float64(d), time.Duration(value.Int()).String()
+	case value.Kind() == reflect.String || value.Kind() == reflect.Slice:
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Sprintf("invalid %s bound %q", name, arg)
+		}
+		got, bound = float64(value.Len()), float64(n)
+		if name == "min" && got < bound {
+			return fmt.Sprintf("length must be at least %s", arg)
+		}
+		if name == "max" && got > bound {
+			return fmt.Sprintf("length must be at most %s", arg)
+		}
+		return ""
+	default:
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid %s bound %q", name, arg)
+		}
+		bound = n
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			got = float64(value.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			got = float64(value.Uint())
+		case reflect.Float32, reflect.Float64:
+			got = value.Float()
+		default:
+			return fmt.Sprintf("%s does not apply to %s", name, value.Kind())
+		}
+		display = fmt.Sprint(value.Interface())
+	}
+	if name == "min" && got < bound {
+		return fmt.Sprintf("must be at least %s (got %s)", arg, display)
+	}
+	if name == "max" && got > bound {
+		return fmt.Sprintf("must be at most %s (got %s)", arg, display)
+	}
+	return ""
+}
+
+// checkOrigin validates one CorsConfiguration.AllowOrigins entry
+func checkOrigin(origin string) string {
+	if origin == "*" {
+		return ""
+	}
+	if expr, ok := strings.CutPrefix(origin, "regex:"); ok {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Sprintf("invalid regex %q: %v", expr, err)
+		}
+		return ""
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return fmt.Sprintf("must be scheme://host[:port], scheme://*.domain, regex:<expr> or * (got %q)", origin)
+	}
+	if strings.Count(origin, "*") > 1 || (strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+		return fmt.Sprintf("wildcard must be the leading label, e.g. https://*.example.com (got %q)", origin)
+	}
+	return ""
+}
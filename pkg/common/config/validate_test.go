@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type validateTestConfig struct {
+	Name  string `mapstructure:"Name" default:"feitian" validate:"required"`
+	Port  string `mapstructure:"Port" default:"8080" validate:"port"`
+	Addr  string `mapstructure:"Addr" default:"127.0.0.1:6379" validate:"hostport"`
+	Level string `mapstructure:"Level" default:"info" validate:"oneof=debug info"`
+	Inner struct {
+		Count   int           `mapstructure:"Count" default:"3" validate:"min=1,max=5"`
+		Timeout time.Duration `mapstructure:"Timeout" default:"5s" validate:"min=1s"`
+		Note    string        `mapstructure:"Note"`
+	} `mapstructure:"Inner"`
+}
+
+func TestSetDefaults(t *testing.T) {
+	vp := viper.New()
+	var conf validateTestConfig
+	setDefaults(vp, &conf)
+	vp.SetConfigType("toml")
+	if err := vp.ReadConfig(strings.NewReader("Level = \"debug\"\n[Inner]\nNote = \"set\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := vp.Unmarshal(&conf); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]interface{}{
+		"Name": conf.Name, "Port": conf.Port, "Addr": conf.Addr, "Level": conf.Level,
+		"Inner.Count": conf.Inner.Count, "Inner.Timeout": conf.Inner.Timeout, "Inner.Note": conf.Inner.Note,
+	}
+	want := map[string]interface{}{
+		"Name": "feitian", "Port": "8080", "Addr": "127.0.0.1:6379", "Level": "debug",
+		"Inner.Count": 3, "Inner.Timeout": 5 * time.Second, "Inner.Note": "set",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %v, want %v", got, want)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	valid := func() validateTestConfig {
+		var c validateTestConfig
+		c.Name, c.Port, c.Addr, c.Level = "feitian", "8080", "127.0.0.1:6379", "info"
+		c.Inner.Count, c.Inner.Timeout = 3, 5*time.Second
+		return c
+	}
+	tests := []struct {
+		name    string
+		modify  func(c *validateTestConfig)
+		wantErr string
+	}{
+		{"valid", func(c *validateTestConfig) {}, ""},
+		{"required", func(c *validateTestConfig) { c.Name = "" }, "Name: is required"},
+		{"port", func(c *validateTestConfig) { c.Port = "65535" }, ""},
+		{"port zero", func(c *validateTestConfig) { c.Port = "0" }, `Port: must be a port between 1 and 65535 (got "0")`},
+		{"port too high", func(c *validateTestConfig) { c.Port = "65536" }, "Port: must be a port"},
+		{"port not a number", func(c *validateTestConfig) { c.Port = "http" }, "Port: must be a port"},
+		{"hostport without host", func(c *validateTestConfig) { c.Addr = ":6379" }, ""},
+		{"hostport ipv6", func(c *validateTestConfig) { c.Addr = "[::1]:6379" }, ""},
+		{"hostport without port", func(c *validateTestConfig) { c.Addr = "redis" }, `Addr: must be host:port (got "redis")`},
+		{"hostport empty port", func(c *validateTestConfig) { c.Addr = "redis:" }, "Addr: must be host:port"},
+		{"oneof", func(c *validateTestConfig) { c.Level = "debug" }, ""},
+		{"oneof other", func(c *validateTestConfig) { c.Level = "trace" }, `Level: must be one of debug, info (got "trace")`},
+		{"oneof is case sensitive", func(c *validateTestConfig) { c.Level = "INFO" }, "Level: must be one of"},
+		{"nested min", func(c *validateTestConfig) { c.Inner.Count = 0 }, "Inner.Count: must be at least 1 (got 0)"},
+		{"nested max", func(c *validateTestConfig) { c.Inner.Count = 6 }, "Inner.Count: must be at most 5 (got 6)"},
+		{"duration min", func(c *validateTestConfig) { c.Inner.Timeout = time.Millisecond }, "Inner.Timeout: must be at least 1s (got 1ms)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := valid()
+			tt.modify(&conf)
+			err := Validate(&conf)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want no error", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], tt.wantErr) {
+				t.Errorf("Validate = %v, want the single problem %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCollectsAllProblems(t *testing.T) {
+	var conf validateTestConfig
+	conf.Port, conf.Addr, conf.Level = "0", "redis", "trace"
+	conf.Inner.Count = 9
+	err := Validate(&conf)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate = %v, want a *ValidationError", err)
+	}
+	want := []string{"Name: ", "Port: ", "Addr: ", "Level: ", "Inner.Count: ", "Inner.Timeout: "}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("problems = %q, want one per invalid field", verr.Problems)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(verr.Problems[i], prefix) {
+			t.Errorf("problem %d = %q, want it about %s", i, verr.Problems[i], strings.TrimSuffix(prefix, ": "))
+		}
+		if !strings.Contains(err.Error(), verr.Problems[i]) {
+			t.Errorf("Error() is missing %q", verr.Problems[i])
+		}
+	}
+	if err := Validate((*validateTestConfig)(nil)); err != nil {
+		t.Errorf("Validate(nil) = %v", err)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	valid := CompressionConfiguration{Enabled: true, MinSize: 1024, Level: -1, Encodings: []string{"zstd", "gzip", "deflate"}}
+	tests := []struct {
+		name    string
+		modify  func(c *CompressionConfiguration)
+		wantErr string
+	}{
+		{"defaults", func(c *CompressionConfiguration) {}, ""},
+		{"fastest level", func(c *CompressionConfiguration) { c.Level = 1 }, ""},
+		{"smallest level", func(c *CompressionConfiguration) { c.Level = 9 }, ""},
+		{"zstd only", func(c *CompressionConfiguration) { c.Encodings = []string{"zstd"} }, ""},
+		{"level 0", func(c *CompressionConfiguration) { c.Level = 0 }, "Compression.Level: 0 disables compression"},
+		{"level too high", func(c *CompressionConfiguration) { c.Level = 10 }, "Compression.Level"},
+		{"unknown encoding", func(c *CompressionConfiguration) { c.Encodings = []string{"gzip", "br"} }, `Compression.Encodings: [1] must be zstd, gzip or deflate (got "br")`},
+		{"no encodings", func(c *CompressionConfiguration) { c.Encodings = nil }, "Compression.Encodings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := struct {
+				Compression CompressionConfiguration `mapstructure:"Compression"`
+			}{valid}
+			tt.modify(&conf.Compression)
+			err := Validate(&conf)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want no error", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want a problem containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	tests := []struct {
+		timeZone string
+		wantErr  bool
+	}{
+		{"Asia/Tokyo", false},
+		{"UTC", false},
+		{"Europe/Berlin", false},
+		{"", true},
+		{"Mars/Olympus", true},
+		{"+09:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeZone, func(t *testing.T) {
+			conf := PostgresConfiguration{Host: "db", Port: 5432, TimeZone: tt.timeZone}
+			err := Validate(&conf)
+			if got := err != nil && strings.Contains(err.Error(), "TimeZone"); got != tt.wantErr {
+				t.Errorf("Validate = %v, want a TimeZone problem %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"addresses and ranges", []string{"10.0.0.0/8", "192.0.2.1", "::1", "fd00::/8"}, ""},
+		{"hostname", []string{"10.0.0.0/8", "proxy.local"}, `TrustedProxies: [1] must be an IP address or CIDR range (got "proxy.local")`},
+		{"bad range", []string{"10.0.0.0/33"}, "TrustedProxies: [0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := ServiceConfiguration{Port: "8080", TrustedProxies: tt.proxies}
+			err := Validate(&conf)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
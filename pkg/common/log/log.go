@@ -27,5 +27,22 @@ func InitLog(loggerConfig config.LoggerConfig) {
 	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
 	multi := zerolog.MultiLevelWriter(consoleWriter, rotatingLogger)
 	log.Logger = zerolog.New(multi).With().Caller().Timestamp().Logger()
+	if err := SetLevel(loggerConfig.Level); err != nil {
+		log.Warn().Err(err).Msg("Invalid log level, logging everything")
+	}
 	log.Info().Msg("Logger initialized")
 }
+
+// SetLevel changes the global log level at runtime; an empty level logs everything
+func SetLevel(level string) error {
+	if level == "" {
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		return nil
+	}
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(parsed)
+	return nil
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memorySweepInterval = time.Minute
+
+// MemoryLimiter keeps sliding windows in process memory. Limits are per node,
+// so it is meant for single-node deployments, development, and as a fallback.
+
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryWindow struct {
+	calls  []time.Time
+	window time.Duration
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{windows: make(map[string]*memoryWindow), now: time.Now}
+}
+
+func (l *MemoryLimiter) Allow(_ context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		l.windows[key] = w
+	}
+	w.window = window
+	w.prune(now)
+
+	if len(w.calls) < limit {
+		w.calls = append(w.calls, now)
+		return true, 0, nil
+	}
+	return false, w.calls[0].Add(window).Sub(now), nil
+}
+
+// sweep drops idle windows so that memory does not grow with every client ever seen
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < memorySweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.windows {
+		w.prune(now)
+		if len(w.calls) == 0 {
+			delete(l.windows, key)
+		}
+	}
+}
+
+func (w *memoryWindow) prune(now time.Time) {
+	cutoff := now.Add(-w.window)
+	i := 0
+	for i < len(w.calls) && !w.calls[i].After(cutoff) {
+		i++
+	}
+	w.calls = w.calls[i:]
+}
@@ -0,0 +1,13 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter implements a sliding-window rate limit: at most limit calls per window for a key.
+// When the call is rejected, retryAfter tells when the next call would be allowed.
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryLimiterSlidingWindow(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name       string
+		offset     time.Duration
+		key        string
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{"first call", 0, "a", true, 0},
+		{"second call", 10 * time.Second, "a", true, 0},
+		{"over the limit", 20 * time.Second, "a", false, 40 * time.Second},
+		{"other key has its own window", 20 * time.Second, "b", true, 0},
+		{"oldest call left the window", 61 * time.Second, "a", true, 0},
+		{"full again", 62 * time.Second, "a", false, 8 * time.Second},
+	}
+	l := NewMemoryLimiter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.now = func() time.Time { return start.Add(tt.offset) }
+			allowed, retryAfter, err := l.Allow(context.Background(), tt.key, 2, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.allowed || retryAfter != tt.retryAfter {
+				t.Errorf("Allow = %v, %v; want %v, %v", allowed, retryAfter, tt.allowed, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewRedisLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, true, false, false} {
+		allowed, retryAfter, err := l.Allow(ctx, "k", 3, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want {
+			t.Fatalf("call %d: allowed = %v, want %v", i+1, allowed, want)
+		}
+		if !allowed && (retryAfter <= 0 || retryAfter > time.Minute) {
+			t.Errorf("call %d: retryAfter = %v, want within the window", i+1, retryAfter)
+		}
+	}
+	if allowed, _, _ := l.Allow(ctx, "other", 3, time.Minute); !allowed {
+		t.Error("a different key must not share the window")
+	}
+}
+
+func TestRedisLimiterFallsBackWhenRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewRedisLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}))
+	mr.Close()
+
+	allowed, _, err := l.Allow(context.Background(), "k", 1, time.Minute)
+	if err != nil || !allowed {
+		t.Fatalf("Allow = %v, %v; want the in-memory fallback to allow the call", allowed, err)
+	}
+	if allowed, _, _ := l.Allow(context.Background(), "k", 1, time.Minute); allowed {
+		t.Error("the fallback must still enforce the limit")
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const redisKeyPrefix = "ratelimit:"
+
+// slidingWindowScript keeps one sorted-set member per accepted call, scored by
+// Redis server time so that replica clock skew does not matter.
+// Returns {allowed, retryAfterMs}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local member = ARGV[3]
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+if redis.call('ZCARD', key) < limit then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	return {1, 0}
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, tonumber(oldest[2]) + window - now}
+`)
+
+// RedisLimiter shares sliding windows between all replicas through Redis.
+// If Redis is unavailable it degrades to the fallback limiter instead of failing calls.
+
+type RedisLimiter struct {
+	redis    *redis.Client
+	fallback Limiter
+}
+
+func NewRedisLimiter(redisConn *redis.Client) *RedisLimiter {
+	return &RedisLimiter{redis: redisConn, fallback: NewMemoryLimiter()}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	member, err := randomMember()
+	if err != nil {
+		return false, 0, err
+	}
+	res, err := slidingWindowScript.Run(ctx, l.redis, []string{redisKeyPrefix + key}, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("redis rate limiter unavailable, using in-memory fallback")
+		return l.fallback.Allow(ctx, key, limit, window)
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+func randomMember() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
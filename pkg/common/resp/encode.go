@@ -0,0 +1,99 @@
+package resp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// Write sends response with the HTTP status
+func Write(ctx *gin.Context, status int, response *RpcResponse) {
+	ctx.Data(status, jsonContentType, Encode(response))
+}
+
+// WriteBatch sends the responses of a batch as a JSON array
+func WriteBatch(ctx *gin.Context, status int, responses []*RpcResponse) {
+	ctx.Data(status, jsonContentType, EncodeBatch(responses))
+}
+
+// Encode returns the JSON of response. The result is marshalled straight into the output,
+// once; a result or error data that cannot be marshalled turns the response into an
+// InternalErrorCode error, keeping its id.
+func Encode(response *RpcResponse) []byte {
+	var buf bytes.Buffer
+	response.encode(&buf)
+	return buf.Bytes()
+}
+
+// EncodeBatch is Encode for the responses of a batch
+func EncodeBatch(responses []*RpcResponse) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, response := range responses {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		response.encode(&buf)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// MarshalJSON lets json.Marshal and gin's ctx.JSON encode a response built by NewResponse
+func (r RpcResponse) MarshalJSON() ([]byte, error) {
+	return Encode(&r), nil
+}
+
+func (r *RpcResponse) encode(buf *bytes.Buffer) {
+	start := buf.Len()
+	if err := r.encodeFields(buf); err != nil {
+		buf.Truncate(start)
+		failed := RpcResponse{JsonRPC: r.JsonRPC, Id: r.Id, Error: NewError(InternalErrorCode, fmt.Sprintf("encode response: %v", err), nil)}
+		_ = failed.encodeFields(buf)
+	}
+}
+
+func (r *RpcResponse) encodeFields(buf *bytes.Buffer) error {
+	enc := json.NewEncoder(buf)
+	buf.WriteString(`{"jsonrpc":`)
+	if err := encodeValue(enc, buf, r.JsonRPC); err != nil {
+		return err
+	}
+	buf.WriteString(`,"id":`)
+	if err := encodeValue(enc, buf, r.Id); err != nil {
+		return err
+	}
+	switch {
+	case r.Error != nil:
+		buf.WriteString(`,"error":`)
+		if err := encodeValue(enc, buf, r.Error); err != nil {
+			return err
+		}
+	case r.Result != nil:
+		buf.WriteString(`,"result":`)
+		if err := encodeValue(enc, buf, r.Result); err != nil {
+			return err
+		}
+	default:
+		// A successful call always has a result member, null included
+		buf.WriteString(`,"result":`)
+		if err := encodeValue(enc, buf, r.value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeValue marshals v into buf, without the newline the encoder appends
+func encodeValue(enc *json.Encoder, buf *bytes.Buffer, v interface{}) error {
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
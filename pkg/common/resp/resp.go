@@ -2,6 +2,7 @@ package resp
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,17 +18,49 @@ type RpcRequest struct {
 	Id      string          `json:"id"`
 }
 
+// Error codes reserved by the JSON-RPC 2.0 specification, plus the
+// implementation-defined server errors (-32000 to -32099) used by this server.
+// Server error codes end with the digits of the closest HTTP status (429 -> -32029).
+
+const (
+	ParseErrorCode            = -32700
+	InvalidRequestCode        = -32600
+	MethodNotFoundCode        = -32601
+	InvalidParamsCode         = -32602
+	InternalErrorCode         = -32603
+	ServerErrorCode           = -32000
+	UnauthorizedCode          = -32001
+	ForbiddenCode             = -32003
+	TimeoutCode               = -32004
+	IdempotencyConflictCode   = -32009
+	RequestTooLargeCode       = -32013
+	IdempotencyInProgressCode = -32025
+	RateLimitedCode           = -32029
+)
+
 type RpcError struct {
 	Code    int         `json:"code"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// NewError builds an RpcError; returning it from a method preserves its code and data in the response
+func NewError(code int, message string, data interface{}) *RpcError {
+	return &RpcError{Code: code, Message: message, Data: data}
+}
+
+func (e *RpcError) Error() string { return e.Message }
+
+// RpcResponse is the response envelope. Clients decode the result from Result; on the server,
+// NewResponse keeps the result value so that it is encoded once, together with the envelope
+// (see Encode).
+
 type RpcResponse struct {
 	JsonRPC string          `json:"jsonrpc"`
 	Id      string          `json:"id"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *RpcError       `json:"error,omitempty"`
+	value   interface{}
 }
 
 func SimpleReturn(ctx *gin.Context, id string, data interface{}) {
@@ -39,17 +72,26 @@ func ErrorReturn(ctx *gin.Context, id string, err error) {
 }
 
 func Return(ctx *gin.Context, code int, id string, data interface{}, err error) {
+	response := NewResponse(id, data, err)
+	Write(ctx, code, &response)
+}
+
+// NewResponse builds the response envelope without writing it, e.g. for one call of a batch
+func NewResponse(id string, data interface{}, err error) RpcResponse {
 	response := RpcResponse{
 		JsonRPC: "2.0",
 		Id:      id,
 	}
 
 	if err != nil {
-		response.Error = &RpcError{Code: -32000, Message: err.Error()}
+		var rpcErr *RpcError
+		if errors.As(err, &rpcErr) {
+			response.Error = rpcErr
+		} else {
+			response.Error = &RpcError{Code: ServerErrorCode, Message: err.Error()}
+		}
 	} else {
-		jsonData, _ := json.Marshal(data)
-		response.Result = jsonData
+		response.value = data
 	}
-
-	ctx.JSON(code, response)
+	return response
 }
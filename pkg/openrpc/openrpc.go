@@ -0,0 +1,100 @@
+package openrpc
+
+// Document is an OpenRPC 1.x document describing a JSON-RPC API
+// Only the parts produced by this server are modelled.
+// https://spec.open-rpc.org/
+
+const Version = "1.3.2"
+
+type Document struct {
+	OpenRPC    string      `json:"openrpc"`
+	Info       Info        `json:"info"`
+	Servers    []Server    `json:"servers,omitempty"`
+	Methods    []Method    `json:"methods"`
+	Components *Components `json:"components,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+// Method describes one JSON-RPC method
+// ParamStructure is always "by-name": params are sent as a JSON object.
+// XParamsSchema carries the params schema when it is not an object with known
+// fields (e.g. a free-form map), in which case Params is empty.
+// XAuthRequired mirrors RpcMethod.RequireAuth.
+
+type Method struct {
+	Name           string               `json:"name"`
+	Summary        string               `json:"summary,omitempty"`
+	Description    string               `json:"description,omitempty"`
+	Params         []*ContentDescriptor `json:"params"`
+	Result         *ContentDescriptor   `json:"result,omitempty"`
+	Errors         []*Error             `json:"errors,omitempty"`
+	ParamStructure string               `json:"paramStructure,omitempty"`
+	XParamsSchema  *Schema              `json:"x-params-schema,omitempty"`
+	XAuthRequired  bool                 `json:"x-auth-required,omitempty"`
+}
+
+type ContentDescriptor struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is the subset of JSON Schema emitted by the reflector
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+// ParamsSchema returns the object schema of a method's params, whichever way they are described
+func (m *Method) ParamsSchema() *Schema {
+	if m.XParamsSchema != nil {
+		return m.XParamsSchema
+	}
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, p := range m.Params {
+		schema.Properties[p.Name] = p.Schema
+		if p.Required {
+			schema.Required = append(schema.Required, p.Name)
+		}
+	}
+	return schema
+}
+
+// RefName returns the component name referenced by a "#/components/schemas/<name>" ref
+func RefName(ref string) string {
+	const prefix = "#/components/schemas/"
+	if len(ref) > len(prefix) && ref[:len(prefix)] == prefix {
+		return ref[len(prefix):]
+	}
+	return ""
+}
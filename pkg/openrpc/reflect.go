@@ -0,0 +1,180 @@
+package openrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	bytesType      = reflect.TypeFor[[]byte]()
+)
+
+// Reflector turns Go types into JSON Schemas following encoding/json rules.
+// Named struct types are emitted once into Components and referenced with $ref.
+// Components are named after the type; when two packages declare the same name,
+// the one reflected later is qualified with its package (e.g. "billing.Order").
+// A `description:"..."` struct tag becomes the property description.
+
+type Reflector struct {
+	Components *Components
+	names      map[reflect.Type]string
+	types      map[string]reflect.Type
+}
+
+func NewReflector() *Reflector {
+	return &Reflector{
+		Components: &Components{Schemas: make(map[string]*Schema)},
+		names:      make(map[reflect.Type]string),
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+// Schema returns the schema of t; a nil type yields the empty (any) schema
+func (r *Reflector) Schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	case bytesType:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := r.Schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		name, ok := r.names[t]
+		if !ok {
+			name = r.componentName(t)
+			// Reserve the name first so recursive types terminate
+			r.names[t] = name
+			r.types[name] = t
+			r.Components.Schemas[name] = &Schema{}
+			*r.Components.Schemas[name] = *r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{} and anything not representable in JSON
+		return &Schema{}
+	}
+}
+
+// componentName returns the name of t in Components: its own name if free, otherwise qualified
+// with the last element of its package path, and with the whole path as a last resort
+func (r *Reflector) componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	candidates := []string{
+		t.Name(),
+		pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name(),
+		strings.ReplaceAll(pkg, "/", ".") + "." + t.Name(),
+	}
+	for _, name := range candidates {
+		if other, taken := r.types[name]; !taken || other == t {
+			return name
+		}
+	}
+	// Distinct types with the same name in the same package: types declared inside functions
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s%d", candidates[2], i)
+		if _, taken := r.types[name]; !taken {
+			return name
+		}
+	}
+}
+
+// InlineSchema is like Schema but never returns a $ref for t itself,
+// which is what method params need to be split into named descriptors
+func (r *Reflector) InlineSchema(t reflect.Type) *Schema {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct && t != timeType {
+		return r.structSchema(t)
+	}
+	return r.Schema(t)
+}
+
+func (r *Reflector) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	r.addFields(schema, t)
+	return schema
+}
+
+func (r *Reflector) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitempty, skip := jsonField(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.addFields(schema, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop := r.Schema(field.Type)
+		// Siblings of $ref are ignored by JSON Schema, so referenced types keep their own description
+		if desc := field.Tag.Get("description"); desc != "" && prop.Ref == "" {
+			prop.Description = desc
+		}
+		schema.Properties[name] = prop
+		if !omitempty && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// jsonField parses the json tag of a field
+func jsonField(field reflect.StructField) (name string, omitempty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" || opt == "omitzero" {
+			omitempty = true
+		}
+	}
+	return parts[0], omitempty, false
+}
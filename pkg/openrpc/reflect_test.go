@@ -0,0 +1,148 @@
+package openrpc
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Decoder shares its name with encoding/json.Decoder
+type Decoder struct {
+	Name string `json:"name"`
+}
+
+type node struct {
+	Value    int     `json:"value" description:"node value"`
+	Children []*node `json:"children,omitempty"`
+}
+
+type base struct {
+	Id string `json:"id"`
+}
+
+type record struct {
+	base
+	Title   string          `json:"title"`
+	Note    *string         `json:"note"`
+	Created time.Time       `json:"created"`
+	Raw     json.RawMessage `json:"raw,omitempty"`
+	Data    []byte          `json:"data,omitzero"`
+	Tags    map[string]int  `json:"tags"`
+	Secret  string          `json:"-"`
+	Plain   bool
+	private int
+}
+
+func TestSchema(t *testing.T) {
+	r := NewReflector()
+	tests := []struct {
+		name string
+		t    reflect.Type
+		want string
+	}{
+		{"nil", nil, `{}`},
+		{"string", reflect.TypeFor[string](), `{"type":"string"}`},
+		{"pointer", reflect.TypeFor[*int](), `{"type":"integer","nullable":true}`},
+		{"slice", reflect.TypeFor[[]float64](), `{"type":"array","items":{"type":"number"}}`},
+		{"map", reflect.TypeFor[map[string]bool](), `{"type":"object","additionalProperties":{"type":"boolean"}}`},
+		{"time", reflect.TypeFor[time.Time](), `{"type":"string","format":"date-time"}`},
+		{"bytes", reflect.TypeFor[[]byte](), `{"type":"string","format":"byte"}`},
+		{"raw message", reflect.TypeFor[json.RawMessage](), `{}`},
+		{"interface", reflect.TypeFor[interface{}](), `{}`},
+		{"named struct", reflect.TypeFor[record](), `{"$ref":"#/components/schemas/record"}`},
+		{"pointer to named struct", reflect.TypeFor[*node](), `{"$ref":"#/components/schemas/node"}`},
+		{"anonymous struct", reflect.TypeFor[struct {
+			A int `json:"a"`
+		}](), `{"type":"object","properties":{"a":{"type":"integer"}},"required":["a"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(r.Schema(tt.t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Schema = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructSchema(t *testing.T) {
+	r := NewReflector()
+	schema := r.InlineSchema(reflect.TypeFor[*record]())
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"Plain", "created", "data", "id", "note", "raw", "tags", "title"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("properties = %v, want %v", names, want)
+	}
+	// Pointers and omitempty/omitzero fields are optional
+	wantRequired := []string{"id", "title", "created", "tags", "Plain"}
+	if !reflect.DeepEqual(schema.Required, wantRequired) {
+		t.Errorf("required = %v, want %v", schema.Required, wantRequired)
+	}
+	if len(r.Components.Schemas) != 0 {
+		t.Errorf("InlineSchema added components %v", r.Components.Schemas)
+	}
+
+	// Recursive types terminate through $ref
+	r.Schema(reflect.TypeFor[node]())
+	n := r.Components.Schemas["node"]
+	if n == nil || n.Properties["children"].Items.Ref != "#/components/schemas/node" {
+		t.Fatalf("node schema = %+v, want children referencing node", n)
+	}
+	if n.Properties["value"].Description != "node value" {
+		t.Errorf("description = %q, want the tag value", n.Properties["value"].Description)
+	}
+}
+
+func TestComponentNameCollisions(t *testing.T) {
+	type Item struct{ A int }
+	first := reflect.TypeFor[Item]()
+	second := func() reflect.Type {
+		type Item struct{ B int }
+		return reflect.TypeFor[Item]()
+	}()
+
+	r := NewReflector()
+	tests := []struct {
+		t    reflect.Type
+		want string
+	}{
+		{reflect.TypeFor[Decoder](), "Decoder"},
+		{reflect.TypeFor[json.Decoder](), "json.Decoder"},
+		{reflect.TypeFor[Decoder](), "Decoder"},
+		{first, "Item"},
+		{second, "openrpc.Item"},
+	}
+	for _, tt := range tests {
+		if got := r.Schema(tt.t).Ref; got != "#/components/schemas/"+tt.want {
+			t.Errorf("%v: $ref = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+	third := func() reflect.Type {
+		type Item struct{ C int }
+		return reflect.TypeFor[Item]()
+	}()
+	fourth := func() reflect.Type {
+		type Item struct{ D int }
+		return reflect.TypeFor[Item]()
+	}()
+	path := "github.com.google.feitian.pkg.openrpc.Item"
+	if got := r.Schema(third).Ref; got != "#/components/schemas/"+path {
+		t.Errorf("third Item: $ref = %q, want the full path", got)
+	}
+	if got := r.Schema(fourth).Ref; got != "#/components/schemas/"+path+"2" {
+		t.Errorf("fourth Item: $ref = %q, want a numbered name", got)
+	}
+	if len(r.Components.Schemas) != 6 {
+		t.Errorf("components = %d, want one per distinct type", len(r.Components.Schemas))
+	}
+}
@@ -0,0 +1,106 @@
+package rpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// Batch collects calls and sends them in one HTTP request.
+// After Send, each BatchCall holds its own error; Send itself only fails on transport errors.
+
+type Batch struct {
+	client *Client
+	calls  []*BatchCall
+	err    error
+}
+
+// BatchCall is one call of a batch; Err is set after Batch.Send
+
+type BatchCall struct {
+	Method string
+	Err    error
+	req    *request
+	result interface{}
+}
+
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Call adds a call whose result will be decoded into result
+func (b *Batch) Call(method string, params, result interface{}) *BatchCall {
+	return b.add(method, params, result, true)
+}
+
+// Notify adds a notification
+func (b *Batch) Notify(method string, params interface{}) *BatchCall {
+	return b.add(method, params, nil, false)
+}
+
+func (b *Batch) add(method string, params, result interface{}, withId bool) *BatchCall {
+	call := &BatchCall{Method: method, result: result}
+	req, err := b.client.newRequest(method, params, withId)
+	if err != nil {
+		call.Err = err
+		if b.err == nil {
+			b.err = err
+		}
+	}
+	call.req = req
+	b.calls = append(b.calls, call)
+	return call
+}
+
+// Send posts the batch. It is retried only when every call in it is an idempotent method.
+func (b *Batch) Send(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.calls) == 0 {
+		return errors.New("rpc: empty batch")
+	}
+	requests := make([]*request, len(b.calls))
+	retry := true
+	for i, call := range b.calls {
+		requests[i] = call.req
+		retry = retry && b.client.idempotent[call.Method]
+	}
+
+	body, err := b.client.post(ctx, requests, retry)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	var responses []resp.RpcResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		// A batch the server rejected as a whole is answered with a single error object
+		var single resp.RpcResponse
+		if json.Unmarshal(body, &single) == nil && single.Error != nil {
+			return single.Error
+		}
+		return fmt.Errorf("rpc: decode batch response: %w", err)
+	}
+
+	byId := make(map[string]*resp.RpcResponse, len(responses))
+	for i := range responses {
+		byId[responses[i].Id] = &responses[i]
+	}
+	for _, call := range b.calls {
+		if call.req.Id == nil {
+			continue
+		}
+		response, ok := byId[*call.req.Id]
+		if !ok {
+			call.Err = fmt.Errorf("rpc: no response for call %s", *call.req.Id)
+			continue
+		}
+		call.Err = decodeResult(response, call.result)
+	}
+	return nil
+}
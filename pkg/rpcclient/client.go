@@ -0,0 +1,264 @@
+package rpcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// TimeoutHeader carries the remaining time of the caller's ctx deadline, in milliseconds
+const TimeoutHeader = "X-Request-Timeout"
+
+// Options configures a Client
+// HTTPClient: defaults to a client with a 30s timeout; Header: sent with every request (e.g. auth);
+// IdempotentMethods: only these methods are retried, up to MaxRetries times with exponential backoff.
+
+type Options struct {
+	HTTPClient        *http.Client
+	Header            http.Header
+	IdempotentMethods []string
+	MaxRetries        int
+	RetryBackoff      time.Duration
+	RetryBackoffMax   time.Duration
+}
+
+// Client is a JSON-RPC 2.0 client over HTTP.
+// Errors returned by the server are decoded into *resp.RpcError and can be inspected with errors.As.
+
+type Client struct {
+	url        string
+	httpClient *http.Client
+	header     http.Header
+	idempotent map[string]bool
+	maxRetries int
+	backoff    time.Duration
+	backoffMax time.Duration
+	nextId     atomic.Uint64
+}
+
+// HTTPError is returned when the server answers with a non-JSON-RPC HTTP error
+
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("rpc: http status %d: %s", e.StatusCode, e.Body)
+}
+
+func New(url string, opts Options) *Client {
+	c := &Client{
+		url:        url,
+		httpClient: opts.HTTPClient,
+		header:     opts.Header.Clone(),
+		idempotent: make(map[string]bool, len(opts.IdempotentMethods)),
+		maxRetries: opts.MaxRetries,
+		backoff:    opts.RetryBackoff,
+		backoffMax: opts.RetryBackoffMax,
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.header == nil {
+		c.header = make(http.Header)
+	}
+	if c.backoff <= 0 {
+		c.backoff = 200 * time.Millisecond
+	}
+	if c.backoffMax <= 0 {
+		c.backoffMax = 5 * time.Second
+	}
+	for _, m := range opts.IdempotentMethods {
+		c.idempotent[m] = true
+	}
+	return c
+}
+
+// Call invokes method with params and decodes the result into result (which may be nil)
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	req, err := c.newRequest(method, params, true)
+	if err != nil {
+		return err
+	}
+	body, err := c.post(ctx, req, c.idempotent[method])
+	if err != nil {
+		return err
+	}
+	var response resp.RpcResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("rpc: decode response: %w", err)
+	}
+	return decodeResult(&response, result)
+}
+
+// Notify sends a notification: the server runs the method but sends no result back
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	req, err := c.newRequest(method, params, false)
+	if err != nil {
+		return err
+	}
+	_, err = c.post(ctx, req, c.idempotent[method])
+	return err
+}
+
+// request mirrors resp.RpcRequest, but omits the id of notifications
+type request struct {
+	JsonRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      *string         `json:"id,omitempty"`
+}
+
+func (c *Client) newRequest(method string, params interface{}, withId bool) (*request, error) {
+	req := &request{JsonRPC: "2.0", Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("rpc: encode params: %w", err)
+		}
+		req.Params = raw
+	}
+	if withId {
+		id := strconv.FormatUint(c.nextId.Add(1), 10)
+		req.Id = &id
+	}
+	return req, nil
+}
+
+// post sends payload and returns the response body, which is empty for notifications.
+// Failed attempts are retried only when retry is set.
+func (c *Client) post(ctx context.Context, payload interface{}, retry bool) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: encode request: %w", err)
+	}
+	attempts := 1
+	if retry {
+		attempts += c.maxRetries
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, attempt, lastErr); err != nil {
+				return nil, err
+			}
+		}
+		body, retryable, err := c.send(ctx, data)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// send performs one HTTP round trip and reports whether a failure may be retried
+func (c *Client) send(ctx context.Context, data []byte) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Let the server give up when the caller does
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(TimeoutHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10))
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusOK || res.StatusCode == http.StatusNoContent:
+		return body, false, nil
+	case res.StatusCode == http.StatusTooManyRequests:
+		err := &retryAfterError{err: responseError(res.StatusCode, body), after: parseRetryAfter(res.Header.Get("Retry-After"))}
+		return nil, true, err
+	case res.StatusCode >= 500:
+		return nil, true, responseError(res.StatusCode, body)
+	default:
+		return nil, false, responseError(res.StatusCode, body)
+	}
+}
+
+func (c *Client) sleep(ctx context.Context, attempt int, lastErr error) error {
+	wait := c.backoff << (attempt - 1)
+	if wait <= 0 || wait > c.backoffMax {
+		wait = c.backoffMax
+	}
+	wait = wait/2 + rand.N(wait/2+1)
+	var ra *retryAfterError
+	if errors.As(lastErr, &ra) && ra.after > wait {
+		wait = ra.after
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfterError carries the server's Retry-After hint to the backoff
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// responseError prefers the JSON-RPC error in an HTTP error body over a plain HTTPError
+func responseError(status int, body []byte) error {
+	var response resp.RpcResponse
+	if json.Unmarshal(body, &response) == nil && response.Error != nil {
+		return response.Error
+	}
+	return &HTTPError{StatusCode: status, Body: string(body)}
+}
+
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func decodeResult(response *resp.RpcResponse, result interface{}) error {
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("rpc: decode result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package rpcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/feitian/pkg/common/resp"
+)
+
+// newTestClient serves handler and returns a client with a short backoff for it
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts Options) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff, opts.RetryBackoffMax = time.Millisecond, 2*time.Millisecond
+	}
+	return New(server.URL, opts)
+}
+
+// echoResult answers a single call with its params as the result
+func echoResult(w http.ResponseWriter, r *http.Request) {
+	var req resp.RpcRequest
+	body, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(body, &req)
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%q,"result":%s}`, req.Id, req.Params)
+}
+
+func TestCallRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		failures     int // answered with failStatus before succeeding
+		failStatus   int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{"idempotent method recovers", "get", 2, http.StatusServiceUnavailable, 3, false},
+		{"idempotent method gives up", "get", 10, http.StatusBadGateway, 4, true},
+		{"other method is not retried", "create", 1, http.StatusServiceUnavailable, 1, true},
+		{"client errors are not retried", "get", 1, http.StatusBadRequest, 1, true},
+		{"rate limited", "get", 1, http.StatusTooManyRequests, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if int(attempts.Add(1)) <= tt.failures {
+					http.Error(w, "unavailable", tt.failStatus)
+					return
+				}
+				echoResult(w, r)
+			}, Options{IdempotentMethods: []string{"get"}, MaxRetries: 3})
+
+			var result map[string]int
+			err := c.Call(context.Background(), tt.method, map[string]int{"n": 1}, &result)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Call error = %v, want error %v", err, tt.wantErr)
+			}
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", n, tt.wantAttempts)
+			}
+			var httpErr *HTTPError
+			if tt.wantErr && (!errors.As(err, &httpErr) || httpErr.StatusCode != tt.failStatus) {
+				t.Errorf("error = %v, want an HTTPError with status %d", err, tt.failStatus)
+			}
+			if !tt.wantErr && result["n"] != 1 {
+				t.Errorf("result = %v, want the echoed params", result)
+			}
+		})
+	}
+}
+
+func TestCallHonoursRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	var first time.Time
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","error":{"code":%d,"message":"rate limited"}}`, resp.RateLimitedCode)
+			return
+		}
+		if waited := time.Since(first); waited < time.Second {
+			t.Errorf("retried after %v, want Retry-After respected", waited)
+		}
+		echoResult(w, r)
+	}, Options{IdempotentMethods: []string{"get"}, MaxRetries: 1})
+	if err := c.Call(context.Background(), "get", nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	// Without retries left the JSON-RPC error of the 429 body is returned
+	c.maxRetries = 0
+	attempts.Store(0)
+	err := c.Call(context.Background(), "get", nil, nil)
+	var rpcErr *resp.RpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != resp.RateLimitedCode {
+		t.Errorf("error = %v, want the RateLimitedCode error", err)
+	}
+
+	// The wait ends with the caller's ctx
+	c.maxRetries = 1
+	attempts.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "get", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the ctx deadline to cut the Retry-After wait", err)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantCode    int // JSON-RPC error code, or 0 for an HTTPError
+		wantMessage string
+		wantStatus  int
+	}{
+		{"error object", http.StatusOK, `{"jsonrpc":"2.0","id":"1","error":{"code":-32602,"message":"bad params","data":{"field":"n"}}}`, resp.InvalidParamsCode, "bad params", 0},
+		{"error in an HTTP error body", http.StatusUnauthorized, `{"jsonrpc":"2.0","id":"1","error":{"code":-32001,"message":"unauthorized"}}`, resp.UnauthorizedCode, "unauthorized", 0},
+		{"plain HTTP error", http.StatusNotFound, "404 page not found", 0, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}, Options{})
+			err := c.Call(context.Background(), "m", nil, nil)
+			var rpcErr *resp.RpcError
+			var httpErr *HTTPError
+			switch {
+			case tt.wantCode != 0 && (!errors.As(err, &rpcErr) || rpcErr.Code != tt.wantCode || rpcErr.Message != tt.wantMessage):
+				t.Errorf("error = %#v, want code %d and message %q", err, tt.wantCode, tt.wantMessage)
+			case tt.wantCode == 0 && (!errors.As(err, &httpErr) || httpErr.StatusCode != tt.wantStatus):
+				t.Errorf("error = %#v, want an HTTPError with status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCallSendsDeadline(t *testing.T) {
+	var header string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(TimeoutHeader)
+		echoResult(w, r)
+	}, Options{Header: http.Header{"X-Api-Key": {"k1"}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Call(ctx, "m", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := strconv.Atoi(header); err != nil || ms <= 0 || ms > 2000 {
+		t.Errorf("%s = %q, want the remaining milliseconds", TimeoutHeader, header)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		var calls []resp.RpcRequest
+		if err := json.NewDecoder(r.Body).Decode(&calls); err != nil {
+			t.Errorf("decode batch: %v", err)
+		}
+		// Answered in reverse order, without the notification and the call "missing"
+		var responses []string
+		for i := len(calls) - 1; i >= 0; i-- {
+			switch calls[i].Method {
+			case "log", "missing":
+			case "fail":
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"error":{"code":%d,"message":"nope"}}`, calls[i].Id, resp.ForbiddenCode))
+			default:
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"result":%s}`, calls[i].Id, calls[i].Params))
+			}
+		}
+		io.WriteString(w, "["+strings.Join(responses, ",")+"]")
+	}, Options{})
+
+	batch := c.Batch()
+	var one, two int
+	first := batch.Call("echo", 1, &one)
+	failing := batch.Call("fail", nil, nil)
+	notification := batch.Notify("log", "x")
+	second := batch.Call("echo", 2, &two)
+	missing := batch.Call("missing", nil, nil)
+	if err := batch.Send(context.Background()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if first.Err != nil || second.Err != nil || one != 1 || two != 2 {
+		t.Errorf("results %d (%v), %d (%v); want each matched to its call by id", one, first.Err, two, second.Err)
+	}
+	var rpcErr *resp.RpcError
+	if !errors.As(failing.Err, &rpcErr) || rpcErr.Code != resp.ForbiddenCode {
+		t.Errorf("failing call error = %v, want its own error", failing.Err)
+	}
+	if notification.Err != nil {
+		t.Errorf("notification error = %v", notification.Err)
+	}
+	if missing.Err == nil {
+		t.Error("call without a response has no error")
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want one request for the batch", attempts.Load())
+	}
+}
+
+func TestBatchRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		methods      []string
+		wantAttempts int32
+	}{
+		{"all idempotent", []string{"get", "list"}, 2},
+		{"one not idempotent", []string{"get", "create"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				io.WriteString(w, `[{"jsonrpc":"2.0","id":"1","result":true},{"jsonrpc":"2.0","id":"2","result":true}]`)
+			}, Options{IdempotentMethods: []string{"get", "list"}, MaxRetries: 2})
+			batch := c.Batch()
+			for _, method := range tt.methods {
+				batch.Call(method, nil, nil)
+			}
+			batch.Send(context.Background())
+			if n := attempts.Load(); n != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+
+	// A batch rejected as a whole reports the server's error
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"","error":{"code":%d,"message":"empty batch"}}`, resp.InvalidRequestCode)
+	}, Options{})
+	batch := c.Batch()
+	batch.Call("get", nil, nil)
+	var rpcErr *resp.RpcError
+	if err := batch.Send(context.Background()); !errors.As(err, &rpcErr) || rpcErr.Code != resp.InvalidRequestCode {
+		t.Errorf("Send = %v, want the batch error", err)
+	}
+}